@@ -0,0 +1,203 @@
+// Package alert sends notifications when a routine changes state.
+//
+// The statusbar engine tracks the state of every routine (for example, "normal", "warning",
+// "error", "failed", or "stopped") and builds an Alert whenever that state changes. The Alert is
+// handed to a Dispatcher, which checks it against each Rule and sends it to the Rule's Notifiers.
+// To keep from being flooded with notifications, the Dispatcher drops duplicate alerts and limits
+// how often each Rule can fire.
+//
+// This package includes Notifiers for freedesktop desktop notifications (over D-Bus), shell
+// commands, and webhooks. To send alerts somewhere else, implement the Notifier interface.
+package alert
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Default amount of time that must pass before an identical alert is sent again.
+const defaultDedupWindow = 10 * time.Minute
+
+// Alert holds the information about a single state transition of a routine.
+type Alert struct {
+	// Module name of the routine, e.g. "sbbattery".
+	Routine string `json:"routine"`
+
+	// Display name of the routine, e.g. "Battery".
+	Name string `json:"name"`
+
+	// State the routine was in before the transition.
+	From string `json:"from"`
+
+	// State the routine is in now.
+	To string `json:"to"`
+
+	// Routine's output (or error message) at the time of the transition.
+	Message string `json:"message"`
+
+	// Time of the transition.
+	Time time.Time `json:"time"`
+}
+
+// Notifier is the interface that wraps the Notify method. Notify sends the alert to its
+// destination. It is run in its own goroutine, so it may block.
+type Notifier interface {
+	Notify(Alert) error
+}
+
+// Rule describes which transitions should trigger an alert and where to send them. An empty
+// Routine, From, or To matches anything.
+type Rule struct {
+	// Module name of the routine to match, e.g. "sbtravisci".
+	Routine string
+
+	// State that the routine must be coming from.
+	From string
+
+	// State that the routine must be going to.
+	To string
+
+	// Minimum amount of time between alerts sent by this rule for the same routine. If this is 0,
+	// then there is no limit.
+	Interval time.Duration
+
+	// Notifiers to send the alert to.
+	Notifiers []Notifier
+}
+
+// Dispatcher matches alerts against its rules and sends them to the matching rules' notifiers. It
+// is safe for concurrent use.
+type Dispatcher struct {
+	mutex sync.Mutex
+
+	// List of rules, in the order they were added.
+	rules []Rule
+
+	// Amount of time that must pass before an identical alert is sent again.
+	dedupWindow time.Duration
+
+	// Time each rule last fired for each routine, keyed by rule index and module name.
+	lastFired map[ruleKey]time.Time
+
+	// Time each unique alert was last sent.
+	lastSent map[alertKey]time.Time
+}
+
+// ruleKey identifies a rule firing for a particular routine.
+type ruleKey struct {
+	rule    int
+	routine string
+}
+
+// alertKey identifies an alert's contents, ignoring the time it happened.
+type alertKey struct {
+	routine string
+	from    string
+	to      string
+	message string
+}
+
+// NewDispatcher creates a new Dispatcher without any rules. Identical alerts are dropped if they
+// occur within 10 minutes of each other, which can be changed with SetDedupWindow.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		dedupWindow: defaultDedupWindow,
+		lastFired:   make(map[ruleKey]time.Time),
+		lastSent:    make(map[alertKey]time.Time),
+	}
+}
+
+// AddRule adds a rule to the dispatcher.
+func (d *Dispatcher) AddRule(rule Rule) {
+	if d == nil {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.rules = append(d.rules, rule)
+}
+
+// SetDedupWindow sets the amount of time that must pass before an identical alert (same routine,
+// transition, and message) is sent again. If window is 0, then duplicates are always sent.
+func (d *Dispatcher) SetDedupWindow(window time.Duration) {
+	if d == nil || window < 0 {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.dedupWindow = window
+}
+
+// Dispatch sends the alert to the notifiers of every rule that matches it. Each notifier runs in its
+// own goroutine, and any errors are logged.
+func (d *Dispatcher) Dispatch(a Alert) {
+	if d == nil {
+		return
+	}
+
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+
+	for _, n := range d.match(a) {
+		go func(n Notifier) {
+			if err := n.Notify(a); err != nil {
+				log.Printf("%s: Failed to send alert: %s", a.Name, err.Error())
+			}
+		}(n)
+	}
+}
+
+// match returns the notifiers that should receive the alert, taking into account duplicate alerts
+// and each rule's rate limit.
+func (d *Dispatcher) match(a Alert) []Notifier {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// Drop the alert if we've already sent the exact same one recently.
+	key := alertKey{a.Routine, a.From, a.To, a.Message}
+	if last, ok := d.lastSent[key]; ok && d.dedupWindow > 0 && a.Time.Sub(last) < d.dedupWindow {
+		return nil
+	}
+
+	var notifiers []Notifier
+	for i, rule := range d.rules {
+		if !rule.matches(a) {
+			continue
+		}
+
+		rk := ruleKey{i, a.Routine}
+		if last, ok := d.lastFired[rk]; ok && rule.Interval > 0 && a.Time.Sub(last) < rule.Interval {
+			continue
+		}
+		d.lastFired[rk] = a.Time
+
+		notifiers = append(notifiers, rule.Notifiers...)
+	}
+
+	if len(notifiers) > 0 {
+		d.lastSent[key] = a.Time
+	}
+
+	return notifiers
+}
+
+// matches checks whether or not the rule applies to the alert.
+func (r Rule) matches(a Alert) bool {
+	if r.Routine != "" && r.Routine != a.Routine {
+		return false
+	}
+	if r.From != "" && r.From != a.From {
+		return false
+	}
+	if r.To != "" && r.To != a.To {
+		return false
+	}
+
+	return true
+}
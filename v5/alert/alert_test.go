@@ -0,0 +1,81 @@
+package alert_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/snhilde/statusbar/v5/alert"
+)
+
+// chanNotifier sends every alert it receives on its channel.
+type chanNotifier chan alert.Alert
+
+func (c chanNotifier) Notify(a alert.Alert) error {
+	c <- a
+	return nil
+}
+
+// count drains the notifier and returns how many alerts it received.
+func (c chanNotifier) count() int {
+	n := 0
+	for {
+		select {
+		case <-c:
+			n++
+		case <-time.After(100 * time.Millisecond):
+			return n
+		}
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Parallel()
+
+	notifier := make(chanNotifier, 10)
+	d := alert.NewDispatcher()
+	d.AddRule(alert.Rule{Routine: "sbbattery", To: "error", Notifiers: []alert.Notifier{notifier}})
+
+	now := time.Now()
+	d.Dispatch(alert.Alert{Routine: "sbbattery", From: "warning", To: "error", Message: "9% BAT", Time: now})
+	if n := notifier.count(); n != 1 {
+		t.Errorf("matching alert: got %d notifications, want 1", n)
+	}
+
+	// Other routines and states don't match the rule.
+	d.Dispatch(alert.Alert{Routine: "sbfan", From: "warning", To: "error", Time: now})
+	d.Dispatch(alert.Alert{Routine: "sbbattery", From: "error", To: "warning", Time: now})
+	if n := notifier.count(); n != 0 {
+		t.Errorf("non-matching alerts: got %d notifications, want 0", n)
+	}
+
+	// The same alert again within the window is a duplicate.
+	d.Dispatch(alert.Alert{Routine: "sbbattery", From: "warning", To: "error", Message: "9% BAT", Time: now.Add(time.Minute)})
+	if n := notifier.count(); n != 0 {
+		t.Errorf("duplicate alert: got %d notifications, want 0", n)
+	}
+
+	// A different message is not a duplicate.
+	d.Dispatch(alert.Alert{Routine: "sbbattery", From: "warning", To: "error", Message: "8% BAT", Time: now.Add(time.Minute)})
+	if n := notifier.count(); n != 1 {
+		t.Errorf("new alert: got %d notifications, want 1", n)
+	}
+}
+
+func TestDispatcherInterval(t *testing.T) {
+	t.Parallel()
+
+	notifier := make(chanNotifier, 10)
+	d := alert.NewDispatcher()
+	d.SetDedupWindow(0)
+	d.AddRule(alert.Rule{To: "failed", Interval: time.Hour, Notifiers: []alert.Notifier{notifier}})
+
+	now := time.Now()
+	d.Dispatch(alert.Alert{Routine: "sbweather", To: "failed", Time: now})
+	d.Dispatch(alert.Alert{Routine: "sbweather", To: "failed", Time: now.Add(time.Minute)})
+	d.Dispatch(alert.Alert{Routine: "sbtravisci", To: "failed", Time: now.Add(time.Minute)})
+	d.Dispatch(alert.Alert{Routine: "sbweather", To: "failed", Time: now.Add(2 * time.Hour)})
+
+	if n := notifier.count(); n != 3 {
+		t.Errorf("got %d notifications, want 3", n)
+	}
+}
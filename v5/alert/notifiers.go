@@ -0,0 +1,159 @@
+// This file contains the Notifiers included with this package.
+
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// Urgency levels for freedesktop notifications.
+const (
+	urgencyLow      = 0
+	urgencyNormal   = 1
+	urgencyCritical = 2
+)
+
+// DBus sends alerts as freedesktop desktop notifications over the D-Bus session bus. This uses the
+// gdbus tool (part of GLib), so it works with any notification daemon that implements the
+// org.freedesktop.Notifications interface, like dunst or notify-osd.
+type DBus struct {
+	// Name of the application that is sending the notification.
+	appName string
+
+	// How long the notification is shown for, in milliseconds. If this is -1, then the
+	// notification daemon decides.
+	timeout int
+}
+
+// NewDBus creates a new DBus notifier. timeout is how long the notification is shown for. If timeout
+// is 0, then the notification daemon's default is used.
+func NewDBus(timeout time.Duration) *DBus {
+	d := &DBus{appName: "statusbar", timeout: -1}
+	if timeout > 0 {
+		d.timeout = int(timeout / time.Millisecond)
+	}
+
+	return d
+}
+
+// Notify sends the alert as a desktop notification. Transitions to the "error" and "failed" states
+// are sent with critical urgency, transitions to the "normal" state with low urgency, and all
+// others with normal urgency.
+func (d *DBus) Notify(a Alert) error {
+	if d == nil {
+		return fmt.Errorf("invalid notifier")
+	}
+
+	urgency := urgencyNormal
+	switch a.To {
+	case "error", "failed":
+		urgency = urgencyCritical
+	case "normal":
+		urgency = urgencyLow
+	}
+
+	summary := fmt.Sprintf("%s is now %s", a.Name, a.To)
+	hints := fmt.Sprintf("{'urgency': <byte %d>}", urgency)
+
+	cmd := exec.Command("gdbus", "call", "--session",
+		"--dest", "org.freedesktop.Notifications",
+		"--object-path", "/org/freedesktop/Notifications",
+		"--method", "org.freedesktop.Notifications.Notify",
+		d.appName, "0", "", summary, a.Message, "[]", hints, strconv.Itoa(d.timeout))
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+
+	return nil
+}
+
+// Command sends alerts by running a program. The details of the alert are passed in these
+// environment variables: STATUSBAR_ROUTINE, STATUSBAR_NAME, STATUSBAR_FROM, STATUSBAR_TO, and
+// STATUSBAR_MESSAGE.
+type Command struct {
+	// Program to run.
+	name string
+
+	// Arguments to pass to the program.
+	args []string
+}
+
+// NewCommand creates a new Command notifier that runs the program name with the given arguments.
+func NewCommand(name string, args ...string) *Command {
+	return &Command{name: name, args: args}
+}
+
+// Notify runs the program and waits for it to finish.
+func (c *Command) Notify(a Alert) error {
+	if c == nil || c.name == "" {
+		return fmt.Errorf("invalid notifier")
+	}
+
+	cmd := exec.Command(c.name, c.args...)
+	cmd.Env = append(os.Environ(),
+		"STATUSBAR_ROUTINE="+a.Routine,
+		"STATUSBAR_NAME="+a.Name,
+		"STATUSBAR_FROM="+a.From,
+		"STATUSBAR_TO="+a.To,
+		"STATUSBAR_MESSAGE="+a.Message,
+	)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+
+	return nil
+}
+
+// Webhook sends alerts as a JSON-encoded Alert in the body of a POST request.
+type Webhook struct {
+	// URL to send the request to.
+	url string
+
+	// Client used to make the requests.
+	client *http.Client
+}
+
+// NewWebhook creates a new Webhook notifier that posts alerts to url.
+func NewWebhook(url string) *Webhook {
+	// Set up our client with a timeout of 30 seconds (the default client does not have a timeout).
+	return &Webhook{
+		url: url,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Notify posts the alert to the webhook's URL. Any response code outside of the 2xx range is
+// treated as an error.
+func (w *Webhook) Notify(a Alert) error {
+	if w == nil || w.url == "" {
+		return fmt.Errorf("invalid notifier")
+	}
+
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+
+	return nil
+}
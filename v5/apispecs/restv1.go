@@ -21,7 +21,8 @@ var RESTV1 = `
 					"response": {
 						"pong": "Simple \"pong\" response, not JSON-encoded."
 					},
-					"callback": "HandleGetPing"
+					"callback": "HandleGetPing",
+					"operation": "Ping"
 				},
 				{
 					"method": "GET",
@@ -30,13 +31,79 @@ var RESTV1 = `
 					"response": {
 						"endpoints": [
 							{
-								"method": "GET",
-								"url": "/url",
-								"description": "endpoint description"
+								"method": {
+									"type": "string",
+									"description": "HTTP method, e.g. \"GET\""
+								},
+								"url": {
+									"type": "string",
+									"description": "Endpoint's URL, relative to the API's prefix"
+								},
+								"description": {
+									"type": "string",
+									"description": "Endpoint's description"
+								}
 							}
 						]
 					},
-					"callback": "HandleGetEndpoints"
+					"callback": "HandleGetEndpoints",
+					"operation": "Endpoints"
+				}
+			]
+		},
+		{
+			"name": "bar",
+			"description": "Endpoints related to what the statusbar is showing",
+			"endpoints": [
+				{
+					"method": "GET",
+					"url": "/bar",
+					"description": "Get the statusbar's current output, as a whole, by region, and by routine.",
+					"response": {
+						"time": {
+							"type": "number",
+							"description": "Time the output was built, in seconds since the Unix epoch"
+						},
+						"output": {
+							"type": "string",
+							"description": "Full output, as sent to dwm"
+						},
+						"regions": {
+							":region": {
+								"type": "string",
+								"description": "Output of the region (\"main\" or \"secondary\")"
+							}
+						},
+						"routines": [
+							{
+								"module": {
+									"type": "string",
+									"description": "Routine's module name"
+								},
+								"name": {
+									"type": "string",
+									"description": "Routine's display name"
+								},
+								"bar": {
+									"type": "string",
+									"description": "Region the routine is displayed in (\"main\" or \"secondary\")"
+								},
+								"output": {
+									"type": "string",
+									"description": "Routine's output, as displayed"
+								}
+							}
+						]
+					},
+					"callback": "HandleGetBar",
+					"operation": "Get"
+				},
+				{
+					"method": "GET",
+					"url": "/bar/stream",
+					"description": "Stream the statusbar's output and routines' state changes as Server-Sent Events. \"frame\" events carry the same data as GET /bar and are sent whenever the output changes. \"state\" events carry the routine, name, from, to, message, and time of each state change.",
+					"callback": "HandleGetBarStream",
+					"operation": "Stream"
 				}
 			]
 		},
@@ -50,7 +117,7 @@ var RESTV1 = `
 					"description": "Get a list of information about all routines.",
 					"response": {
 						"routines": {
-							"routineName": {
+							":routine": {
 								"name": {
 									"type": "string",
 									"description": "Routine's name"
@@ -66,18 +133,35 @@ var RESTV1 = `
 								"active": {
 									"type": "boolean",
 									"description": "Whether or not routine is currently active"
+								},
+								"schedule": {
+									"type": "string",
+									"description": "Routine's schedule, if it does not run on its interval"
+								},
+								"last_success": {
+									"type": "number",
+									"description": "Time of the routine's last successful update, in seconds since the Unix epoch (0 if never)"
+								},
+								"last_error": {
+									"type": "number",
+									"description": "Time of the routine's last failed update, in seconds since the Unix epoch (0 if never)"
+								},
+								"error_count": {
+									"type": "number",
+									"description": "Number of failed updates since the routine was added"
 								}
 							}
 						}
 					},
-					"callback": "HandleGetRoutineAll"
+					"callback": "HandleGetRoutineAll",
+					"operation": "List"
 				},
 				{
 					"method": "GET",
 					"url": "/routines/:routine",
 					"description": "Get information about the specified routine.",
 					"response": {
-						"routineName": {
+						":routine": {
 							"name": {
 								"type": "string",
 								"description": "Routine's name"
@@ -93,23 +177,65 @@ var RESTV1 = `
 							"active": {
 								"type": "boolean",
 								"description": "Whether or not routine is currently active"
+							},
+							"schedule": {
+								"type": "string",
+								"description": "Routine's schedule, if it does not run on its interval"
+							},
+							"last_success": {
+								"type": "number",
+								"description": "Time of the routine's last successful update, in seconds since the Unix epoch (0 if never)"
+							},
+							"last_error": {
+								"type": "number",
+								"description": "Time of the routine's last failed update, in seconds since the Unix epoch (0 if never)"
+							},
+							"error_count": {
+								"type": "number",
+								"description": "Number of failed updates since the routine was added"
 							}
 						}
 					},
-					"callback": "HandleGetRoutine"
+					"callback": "HandleGetRoutine",
+					"operation": "Get"
+				},
+				{
+					"method": "GET",
+					"url": "/routines/:routine/history",
+					"description": "Get the recorded metrics of the specified routine, from oldest to newest.",
+					"response": {
+						":routine": [
+							{
+								"time": {
+									"type": "number",
+									"description": "Time the sample was recorded, in seconds since the Unix epoch"
+								},
+								"metrics": {
+									":metric": {
+										"type": "number",
+										"description": "Value of the metric"
+									}
+								}
+							}
+						]
+					},
+					"callback": "HandleGetRoutineHistory",
+					"operation": "History"
 				},
 
 				{
 					"method": "PUT",
 					"url": "/routines",
 					"description": "Restart all routines.",
-					"callback": "HandlePutRoutineAll"
+					"callback": "HandlePutRoutineAll",
+					"operation": "RefreshAll"
 				},
 				{
 					"method": "PUT",
 					"url": "/routines/:routine",
 					"description": "Restart the specified routine.",
-					"callback": "HandlePutRoutine"
+					"callback": "HandlePutRoutine",
+					"operation": "Refresh"
 				},
 
 				{
@@ -118,24 +244,31 @@ var RESTV1 = `
 					"description": "Modify the specified routine's settings.",
 					"request": {
 						"interval": {
-							"type": "number",
-							"description": "New update interval, in seconds"
+							"type": "integer",
+							"description": "New update interval, in seconds. This replaces the schedule."
+						},
+						"schedule": {
+							"type": "string",
+							"description": "New schedule, e.g. \"@aligned 1m\" or \"0 7 * * *\". An empty string switches back to the interval."
 						}
 					},
-					"callback": "HandlePatchRoutine"
+					"callback": "HandlePatchRoutine",
+					"operation": "Update"
 				},
 
 				{
 					"method": "DELETE",
 					"url": "/routines",
 					"description": "Stop all routines.",
-					"callback": "HandleDeleteRoutineAll"
+					"callback": "HandleDeleteRoutineAll",
+					"operation": "StopAll"
 				},
 				{
 					"method": "DELETE",
 					"url": "/routines/:routine",
 					"description": "Stop the specified routine.",
-					"callback": "HandleDeleteRoutine"
+					"callback": "HandleDeleteRoutine",
+					"operation": "Stop"
 				}
 			]
 		}
@@ -0,0 +1,849 @@
+// This file contains the JSON implementation (v2) of the RestAPI spec.
+
+package apispecs
+
+// RESTV2 is version 2 of the REST API specification. Errors from every v2 endpoint use the same
+// envelope: {"error": "<message>", "code": "<code>"}.
+var RESTV2 = `
+{
+	"name": "REST API",
+	"prefix": "/rest/v2",
+	"description": "List of endpoints for the v2 REST API",
+	"version": 2.0,
+	"tables": [
+		{
+			"name": "general",
+			"description": "General endpoints for using the API",
+			"endpoints": [
+				{
+					"method": "GET",
+					"url": "/ping",
+					"description": "Ping the system.",
+					"response": {
+						"pong": "Simple \"pong\" response, not JSON-encoded."
+					},
+					"callback": "HandleGetPing"
+				},
+				{
+					"method": "GET",
+					"url": "/endpoints",
+					"description": "Get a list of valid endpoints.",
+					"response": {
+						"endpoints": [
+							{
+								"method": {
+									"type": "string",
+									"description": "HTTP method, e.g. \"GET\""
+								},
+								"url": {
+									"type": "string",
+									"description": "Endpoint's URL, relative to the API's prefix"
+								},
+								"description": {
+									"type": "string",
+									"description": "Endpoint's description"
+								}
+							}
+						]
+					},
+					"callback": "HandleGetEndpoints"
+				},
+				{
+					"method": "GET",
+					"url": "/health",
+					"description": "Get the state of the API's listeners.",
+					"response": {
+						"ready": {
+							"type": "boolean",
+							"description": "Whether or not the API is serving requests over TCP"
+						},
+						"address": {
+							"type": "string",
+							"description": "Address the API is listening on over TCP, or an empty string if it isn't"
+						},
+						"sockets": [
+							{
+								"type": "string",
+								"description": "Path of a Unix socket the API is listening on"
+							}
+						],
+						"error": {
+							"type": "string",
+							"description": "Error that stopped the TCP listener, if it stopped on its own"
+						}
+					},
+					"callback": "HandleGetHealth"
+				},
+				{
+					"method": "PUT",
+					"url": "/listener",
+					"description": "Move the API's TCP listener to a new address. The API keeps listening on the old address if it can't listen on the new one.",
+					"request": {
+						"host": {
+							"type": "string",
+							"description": "Host or IP address to listen on (default is the current host)"
+						},
+						"port": {
+							"type": "integer",
+							"description": "Port to listen on (default is the current port)"
+						}
+					},
+					"response": {
+						"ready": {
+							"type": "boolean",
+							"description": "Whether or not the API is serving requests over TCP"
+						},
+						"address": {
+							"type": "string",
+							"description": "Address the API is now listening on over TCP"
+						},
+						"sockets": [
+							{
+								"type": "string",
+								"description": "Path of a Unix socket the API is listening on"
+							}
+						],
+						"error": {
+							"type": "string",
+							"description": "Error that stopped the TCP listener, if it stopped on its own"
+						}
+					},
+					"callback": "HandlePutListener"
+				}
+			]
+		},
+		{
+			"name": "bar",
+			"description": "Endpoints related to what the statusbar is showing",
+			"endpoints": [
+				{
+					"method": "GET",
+					"url": "/bar",
+					"description": "Get the statusbar's current output, as a whole, by region, and by routine.",
+					"response": {
+						"time": {
+							"type": "number",
+							"description": "Time the output was built, in seconds since the Unix epoch"
+						},
+						"output": {
+							"type": "string",
+							"description": "Full output, as sent to dwm"
+						},
+						"regions": {
+							":region": {
+								"type": "string",
+								"description": "Output of the region (\"main\" or \"secondary\")"
+							}
+						},
+						"routines": [
+							{
+								"module": {
+									"type": "string",
+									"description": "Routine's module name"
+								},
+								"name": {
+									"type": "string",
+									"description": "Routine's display name"
+								},
+								"bar": {
+									"type": "string",
+									"description": "Region the routine is displayed in (\"main\" or \"secondary\")"
+								},
+								"output": {
+									"type": "string",
+									"description": "Routine's output, as displayed"
+								}
+							}
+						]
+					},
+					"callback": "HandleGetBar"
+				},
+				{
+					"method": "GET",
+					"url": "/bar/stream",
+					"description": "Stream the statusbar's output and routines' state changes as Server-Sent Events. \"frame\" events carry the same data as GET /bar and are sent whenever the output changes. \"state\" events carry the routine, name, from, to, message, and time of each state change.",
+					"callback": "HandleGetBarStream"
+				}
+			]
+		},
+		{
+			"name": "routines",
+			"description": "Endpoints related to accessing and manipulating routines",
+			"endpoints": [
+				{
+					"method": "GET",
+					"url": "/routines",
+					"description": "Get the full information of every routine, in display order.",
+					"response": {
+						"routines": [
+							{
+								"id": {
+									"type": "string",
+									"description": "Routine's unique ID: its module name, with a number added if more than one routine uses the same module"
+								},
+								"module": {
+									"type": "string",
+									"description": "Routine's module name"
+								},
+								"name": {
+									"type": "string",
+									"description": "Routine's display name"
+								},
+								"state": {
+									"type": "string",
+									"description": "Routine's current state: \"normal\", \"warning\", \"error\", \"failed\", or \"stopped\""
+								},
+								"active": {
+									"type": "boolean",
+									"description": "Whether or not the routine is running"
+								},
+								"paused": {
+									"type": "boolean",
+									"description": "Whether or not the routine's scheduled updates are paused"
+								},
+								"output": {
+									"type": "string",
+									"description": "Routine's last good output"
+								},
+								"last_error_message": {
+									"type": "string",
+									"description": "Error from the routine's last failed update"
+								},
+								"error_count": {
+									"type": "integer",
+									"description": "Number of failed updates since the routine was added"
+								},
+								"interval": {
+									"type": "integer",
+									"description": "Routine's update interval, in seconds"
+								},
+								"schedule": {
+									"type": "string",
+									"description": "Routine's schedule, if it does not run on its interval"
+								},
+								"uptime": {
+									"type": "integer",
+									"description": "Routine's uptime, in seconds"
+								},
+								"started_at": {
+									"type": "string",
+									"description": "Time the routine was started, in RFC 3339 format (empty if not running)"
+								},
+								"last_success_at": {
+									"type": "string",
+									"description": "Time of the routine's last successful update, in RFC 3339 format (empty if never)"
+								},
+								"last_error_at": {
+									"type": "string",
+									"description": "Time of the routine's last failed update, in RFC 3339 format (empty if never)"
+								},
+								"position": {
+									"type": "integer",
+									"description": "Routine's position within its region of the bar, starting at 0"
+								},
+								"bar": {
+									"type": "string",
+									"description": "Region of the bar the routine is displayed in: \"main\" or \"secondary\""
+								},
+								"colors": {
+									"foreground": {
+										"type": "string",
+										"description": "Foreground color, e.g. \"#FF0000\" (empty to use the routine's own colors)"
+									},
+									"background": {
+										"type": "string",
+										"description": "Background color, e.g. \"#000000\" (empty to use the routine's own colors)"
+									}
+								}
+							}
+						]
+					},
+					"callback": "HandleGetRoutineAll"
+				},
+				{
+					"method": "GET",
+					"url": "/routines/:routine",
+					"description": "Get the full information of the specified routine.",
+					"response": {
+						"id": {
+							"type": "string",
+							"description": "Routine's unique ID: its module name, with a number added if more than one routine uses the same module"
+						},
+						"module": {
+							"type": "string",
+							"description": "Routine's module name"
+						},
+						"name": {
+							"type": "string",
+							"description": "Routine's display name"
+						},
+						"state": {
+							"type": "string",
+							"description": "Routine's current state: \"normal\", \"warning\", \"error\", \"failed\", or \"stopped\""
+						},
+						"active": {
+							"type": "boolean",
+							"description": "Whether or not the routine is running"
+						},
+						"paused": {
+							"type": "boolean",
+							"description": "Whether or not the routine's scheduled updates are paused"
+						},
+						"output": {
+							"type": "string",
+							"description": "Routine's last good output"
+						},
+						"last_error_message": {
+							"type": "string",
+							"description": "Error from the routine's last failed update"
+						},
+						"error_count": {
+							"type": "integer",
+							"description": "Number of failed updates since the routine was added"
+						},
+						"interval": {
+							"type": "integer",
+							"description": "Routine's update interval, in seconds"
+						},
+						"schedule": {
+							"type": "string",
+							"description": "Routine's schedule, if it does not run on its interval"
+						},
+						"uptime": {
+							"type": "integer",
+							"description": "Routine's uptime, in seconds"
+						},
+						"started_at": {
+							"type": "string",
+							"description": "Time the routine was started, in RFC 3339 format (empty if not running)"
+						},
+						"last_success_at": {
+							"type": "string",
+							"description": "Time of the routine's last successful update, in RFC 3339 format (empty if never)"
+						},
+						"last_error_at": {
+							"type": "string",
+							"description": "Time of the routine's last failed update, in RFC 3339 format (empty if never)"
+						},
+						"position": {
+							"type": "integer",
+							"description": "Routine's position within its region of the bar, starting at 0"
+						},
+						"bar": {
+							"type": "string",
+							"description": "Region of the bar the routine is displayed in: \"main\" or \"secondary\""
+						},
+						"colors": {
+							"foreground": {
+								"type": "string",
+								"description": "Foreground color, e.g. \"#FF0000\" (empty to use the routine's own colors)"
+							},
+							"background": {
+								"type": "string",
+								"description": "Background color, e.g. \"#000000\" (empty to use the routine's own colors)"
+							}
+						}
+					},
+					"callback": "HandleGetRoutine"
+				},
+				{
+					"method": "GET",
+					"url": "/routines/:routine/history",
+					"description": "Get the recorded metrics of the specified routine, from oldest to newest.",
+					"response": {
+						"history": [
+							{
+								"time": {
+									"type": "integer",
+									"description": "Time the sample was recorded, in seconds since the Unix epoch"
+								},
+								"metrics": {
+									":metric": {
+										"type": "number",
+										"description": "Value of the metric"
+									}
+								}
+							}
+						]
+					},
+					"callback": "HandleGetRoutineHistory"
+				},
+				{
+					"method": "PATCH",
+					"url": "/routines/:routine",
+					"description": "Change the specified routine's settings. Every field is optional. Responds with the updated routine.",
+					"request": {
+						"name": {
+							"type": "string",
+							"description": "New display name (empty to use the routine's own name)"
+						},
+						"interval": {
+							"type": "integer",
+							"description": "New update interval, in seconds. This replaces the schedule."
+						},
+						"schedule": {
+							"type": "string",
+							"description": "New schedule, e.g. \"@aligned 1m\" or \"0 7 * * *\". An empty string switches back to the interval."
+						},
+						"position": {
+							"type": "integer",
+							"description": "New position within the routine's region of the bar, starting at 0"
+						},
+						"bar": {
+							"type": "string",
+							"description": "Region of the bar to move the routine to: \"main\" or \"secondary\""
+						},
+						"colors": {
+							"foreground": {
+								"type": "string",
+								"description": "Foreground color, e.g. \"#FF0000\" (empty to use the routine's own colors)"
+							},
+							"background": {
+								"type": "string",
+								"description": "Background color, e.g. \"#000000\" (empty to use the routine's own colors)"
+							}
+						}
+					},
+					"response": {
+						"id": {
+							"type": "string",
+							"description": "Routine's unique ID: its module name, with a number added if more than one routine uses the same module"
+						},
+						"module": {
+							"type": "string",
+							"description": "Routine's module name"
+						},
+						"name": {
+							"type": "string",
+							"description": "Routine's display name"
+						},
+						"state": {
+							"type": "string",
+							"description": "Routine's current state: \"normal\", \"warning\", \"error\", \"failed\", or \"stopped\""
+						},
+						"active": {
+							"type": "boolean",
+							"description": "Whether or not the routine is running"
+						},
+						"paused": {
+							"type": "boolean",
+							"description": "Whether or not the routine's scheduled updates are paused"
+						},
+						"output": {
+							"type": "string",
+							"description": "Routine's last good output"
+						},
+						"last_error_message": {
+							"type": "string",
+							"description": "Error from the routine's last failed update"
+						},
+						"error_count": {
+							"type": "integer",
+							"description": "Number of failed updates since the routine was added"
+						},
+						"interval": {
+							"type": "integer",
+							"description": "Routine's update interval, in seconds"
+						},
+						"schedule": {
+							"type": "string",
+							"description": "Routine's schedule, if it does not run on its interval"
+						},
+						"uptime": {
+							"type": "integer",
+							"description": "Routine's uptime, in seconds"
+						},
+						"started_at": {
+							"type": "string",
+							"description": "Time the routine was started, in RFC 3339 format (empty if not running)"
+						},
+						"last_success_at": {
+							"type": "string",
+							"description": "Time of the routine's last successful update, in RFC 3339 format (empty if never)"
+						},
+						"last_error_at": {
+							"type": "string",
+							"description": "Time of the routine's last failed update, in RFC 3339 format (empty if never)"
+						},
+						"position": {
+							"type": "integer",
+							"description": "Routine's position within its region of the bar, starting at 0"
+						},
+						"bar": {
+							"type": "string",
+							"description": "Region of the bar the routine is displayed in: \"main\" or \"secondary\""
+						},
+						"colors": {
+							"foreground": {
+								"type": "string",
+								"description": "Foreground color, e.g. \"#FF0000\" (empty to use the routine's own colors)"
+							},
+							"background": {
+								"type": "string",
+								"description": "Background color, e.g. \"#000000\" (empty to use the routine's own colors)"
+							}
+						}
+					},
+					"callback": "HandlePatchRoutine"
+				},
+				{
+					"method": "DELETE",
+					"url": "/routines/:routine",
+					"description": "Stop the specified routine.",
+					"callback": "HandleDeleteRoutine"
+				}
+			]
+		},
+		{
+			"name": "actions",
+			"description": "Actions that can be taken on a routine. Each responds with the routine's updated information.",
+			"endpoints": [
+				{
+					"method": "POST",
+					"url": "/routines/:routine/refresh",
+					"description": "Update the specified routine right away, even if it is paused.",
+					"response": {
+						"id": {
+							"type": "string",
+							"description": "Routine's unique ID: its module name, with a number added if more than one routine uses the same module"
+						},
+						"module": {
+							"type": "string",
+							"description": "Routine's module name"
+						},
+						"name": {
+							"type": "string",
+							"description": "Routine's display name"
+						},
+						"state": {
+							"type": "string",
+							"description": "Routine's current state: \"normal\", \"warning\", \"error\", \"failed\", or \"stopped\""
+						},
+						"active": {
+							"type": "boolean",
+							"description": "Whether or not the routine is running"
+						},
+						"paused": {
+							"type": "boolean",
+							"description": "Whether or not the routine's scheduled updates are paused"
+						},
+						"output": {
+							"type": "string",
+							"description": "Routine's last good output"
+						},
+						"last_error_message": {
+							"type": "string",
+							"description": "Error from the routine's last failed update"
+						},
+						"error_count": {
+							"type": "integer",
+							"description": "Number of failed updates since the routine was added"
+						},
+						"interval": {
+							"type": "integer",
+							"description": "Routine's update interval, in seconds"
+						},
+						"schedule": {
+							"type": "string",
+							"description": "Routine's schedule, if it does not run on its interval"
+						},
+						"uptime": {
+							"type": "integer",
+							"description": "Routine's uptime, in seconds"
+						},
+						"started_at": {
+							"type": "string",
+							"description": "Time the routine was started, in RFC 3339 format (empty if not running)"
+						},
+						"last_success_at": {
+							"type": "string",
+							"description": "Time of the routine's last successful update, in RFC 3339 format (empty if never)"
+						},
+						"last_error_at": {
+							"type": "string",
+							"description": "Time of the routine's last failed update, in RFC 3339 format (empty if never)"
+						},
+						"position": {
+							"type": "integer",
+							"description": "Routine's position within its region of the bar, starting at 0"
+						},
+						"bar": {
+							"type": "string",
+							"description": "Region of the bar the routine is displayed in: \"main\" or \"secondary\""
+						},
+						"colors": {
+							"foreground": {
+								"type": "string",
+								"description": "Foreground color, e.g. \"#FF0000\" (empty to use the routine's own colors)"
+							},
+							"background": {
+								"type": "string",
+								"description": "Background color, e.g. \"#000000\" (empty to use the routine's own colors)"
+							}
+						}
+					},
+					"callback": "HandlePostRoutineRefresh"
+				},
+				{
+					"method": "POST",
+					"url": "/routines/:routine/pause",
+					"description": "Pause the specified routine's scheduled updates. The routine keeps showing its last output.",
+					"response": {
+						"id": {
+							"type": "string",
+							"description": "Routine's unique ID: its module name, with a number added if more than one routine uses the same module"
+						},
+						"module": {
+							"type": "string",
+							"description": "Routine's module name"
+						},
+						"name": {
+							"type": "string",
+							"description": "Routine's display name"
+						},
+						"state": {
+							"type": "string",
+							"description": "Routine's current state: \"normal\", \"warning\", \"error\", \"failed\", or \"stopped\""
+						},
+						"active": {
+							"type": "boolean",
+							"description": "Whether or not the routine is running"
+						},
+						"paused": {
+							"type": "boolean",
+							"description": "Whether or not the routine's scheduled updates are paused"
+						},
+						"output": {
+							"type": "string",
+							"description": "Routine's last good output"
+						},
+						"last_error_message": {
+							"type": "string",
+							"description": "Error from the routine's last failed update"
+						},
+						"error_count": {
+							"type": "integer",
+							"description": "Number of failed updates since the routine was added"
+						},
+						"interval": {
+							"type": "integer",
+							"description": "Routine's update interval, in seconds"
+						},
+						"schedule": {
+							"type": "string",
+							"description": "Routine's schedule, if it does not run on its interval"
+						},
+						"uptime": {
+							"type": "integer",
+							"description": "Routine's uptime, in seconds"
+						},
+						"started_at": {
+							"type": "string",
+							"description": "Time the routine was started, in RFC 3339 format (empty if not running)"
+						},
+						"last_success_at": {
+							"type": "string",
+							"description": "Time of the routine's last successful update, in RFC 3339 format (empty if never)"
+						},
+						"last_error_at": {
+							"type": "string",
+							"description": "Time of the routine's last failed update, in RFC 3339 format (empty if never)"
+						},
+						"position": {
+							"type": "integer",
+							"description": "Routine's position within its region of the bar, starting at 0"
+						},
+						"bar": {
+							"type": "string",
+							"description": "Region of the bar the routine is displayed in: \"main\" or \"secondary\""
+						},
+						"colors": {
+							"foreground": {
+								"type": "string",
+								"description": "Foreground color, e.g. \"#FF0000\" (empty to use the routine's own colors)"
+							},
+							"background": {
+								"type": "string",
+								"description": "Background color, e.g. \"#000000\" (empty to use the routine's own colors)"
+							}
+						}
+					},
+					"callback": "HandlePostRoutinePause"
+				},
+				{
+					"method": "POST",
+					"url": "/routines/:routine/resume",
+					"description": "Resume the specified routine's scheduled updates and update it right away.",
+					"response": {
+						"id": {
+							"type": "string",
+							"description": "Routine's unique ID: its module name, with a number added if more than one routine uses the same module"
+						},
+						"module": {
+							"type": "string",
+							"description": "Routine's module name"
+						},
+						"name": {
+							"type": "string",
+							"description": "Routine's display name"
+						},
+						"state": {
+							"type": "string",
+							"description": "Routine's current state: \"normal\", \"warning\", \"error\", \"failed\", or \"stopped\""
+						},
+						"active": {
+							"type": "boolean",
+							"description": "Whether or not the routine is running"
+						},
+						"paused": {
+							"type": "boolean",
+							"description": "Whether or not the routine's scheduled updates are paused"
+						},
+						"output": {
+							"type": "string",
+							"description": "Routine's last good output"
+						},
+						"last_error_message": {
+							"type": "string",
+							"description": "Error from the routine's last failed update"
+						},
+						"error_count": {
+							"type": "integer",
+							"description": "Number of failed updates since the routine was added"
+						},
+						"interval": {
+							"type": "integer",
+							"description": "Routine's update interval, in seconds"
+						},
+						"schedule": {
+							"type": "string",
+							"description": "Routine's schedule, if it does not run on its interval"
+						},
+						"uptime": {
+							"type": "integer",
+							"description": "Routine's uptime, in seconds"
+						},
+						"started_at": {
+							"type": "string",
+							"description": "Time the routine was started, in RFC 3339 format (empty if not running)"
+						},
+						"last_success_at": {
+							"type": "string",
+							"description": "Time of the routine's last successful update, in RFC 3339 format (empty if never)"
+						},
+						"last_error_at": {
+							"type": "string",
+							"description": "Time of the routine's last failed update, in RFC 3339 format (empty if never)"
+						},
+						"position": {
+							"type": "integer",
+							"description": "Routine's position within its region of the bar, starting at 0"
+						},
+						"bar": {
+							"type": "string",
+							"description": "Region of the bar the routine is displayed in: \"main\" or \"secondary\""
+						},
+						"colors": {
+							"foreground": {
+								"type": "string",
+								"description": "Foreground color, e.g. \"#FF0000\" (empty to use the routine's own colors)"
+							},
+							"background": {
+								"type": "string",
+								"description": "Background color, e.g. \"#000000\" (empty to use the routine's own colors)"
+							}
+						}
+					},
+					"callback": "HandlePostRoutineResume"
+				},
+				{
+					"method": "POST",
+					"url": "/routines/:routine/restart",
+					"description": "Stop the specified routine (if it is running) and start it again.",
+					"response": {
+						"id": {
+							"type": "string",
+							"description": "Routine's unique ID: its module name, with a number added if more than one routine uses the same module"
+						},
+						"module": {
+							"type": "string",
+							"description": "Routine's module name"
+						},
+						"name": {
+							"type": "string",
+							"description": "Routine's display name"
+						},
+						"state": {
+							"type": "string",
+							"description": "Routine's current state: \"normal\", \"warning\", \"error\", \"failed\", or \"stopped\""
+						},
+						"active": {
+							"type": "boolean",
+							"description": "Whether or not the routine is running"
+						},
+						"paused": {
+							"type": "boolean",
+							"description": "Whether or not the routine's scheduled updates are paused"
+						},
+						"output": {
+							"type": "string",
+							"description": "Routine's last good output"
+						},
+						"last_error_message": {
+							"type": "string",
+							"description": "Error from the routine's last failed update"
+						},
+						"error_count": {
+							"type": "integer",
+							"description": "Number of failed updates since the routine was added"
+						},
+						"interval": {
+							"type": "integer",
+							"description": "Routine's update interval, in seconds"
+						},
+						"schedule": {
+							"type": "string",
+							"description": "Routine's schedule, if it does not run on its interval"
+						},
+						"uptime": {
+							"type": "integer",
+							"description": "Routine's uptime, in seconds"
+						},
+						"started_at": {
+							"type": "string",
+							"description": "Time the routine was started, in RFC 3339 format (empty if not running)"
+						},
+						"last_success_at": {
+							"type": "string",
+							"description": "Time of the routine's last successful update, in RFC 3339 format (empty if never)"
+						},
+						"last_error_at": {
+							"type": "string",
+							"description": "Time of the routine's last failed update, in RFC 3339 format (empty if never)"
+						},
+						"position": {
+							"type": "integer",
+							"description": "Routine's position within its region of the bar, starting at 0"
+						},
+						"bar": {
+							"type": "string",
+							"description": "Region of the bar the routine is displayed in: \"main\" or \"secondary\""
+						},
+						"colors": {
+							"foreground": {
+								"type": "string",
+								"description": "Foreground color, e.g. \"#FF0000\" (empty to use the routine's own colors)"
+							},
+							"background": {
+								"type": "string",
+								"description": "Background color, e.g. \"#000000\" (empty to use the routine's own colors)"
+							}
+						}
+					},
+					"callback": "HandlePostRoutineRestart"
+				}
+			]
+		}
+	]
+}
+`
@@ -0,0 +1,460 @@
+// Code generated by clientgen. DO NOT EDIT.
+
+// Package client is a client for the REST API (/rest/v1), version 1.0.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// prefix is the path prefix of every endpoint.
+const prefix = "/rest/v1"
+
+// Client is a client for the API. Each group of endpoints is handled by one of its services.
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+
+	// General endpoints for using the API
+	General *GeneralService
+
+	// Endpoints related to what the statusbar is showing
+	Bar *BarService
+
+	// Endpoints related to accessing and manipulating rountines
+	Routines *RoutinesService
+}
+
+// Error is an error response from the API.
+type Error struct {
+	// HTTP status code of the response.
+	StatusCode int `json:"-"`
+
+	// Human-readable error message.
+	Message string `json:"error"`
+
+	// Machine-readable error code, if the API sent one.
+	Code string `json:"code,omitempty"`
+
+	// Invalid fields in the request, if any.
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError describes a single invalid field in a request.
+type FieldError struct {
+	// Path to the field, e.g. "colors.foreground".
+	Field string `json:"field"`
+
+	// What is wrong with the field.
+	Message string `json:"message"`
+}
+
+// Error formats the error response.
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
+	for _, f := range e.Fields {
+		msg += fmt.Sprintf("; %s: %s", f.Field, f.Message)
+	}
+
+	return fmt.Sprintf("%d: %s", e.StatusCode, msg)
+}
+
+// New creates a new client for the API at baseURL, e.g. "http://localhost:1234".
+func New(baseURL string) *Client {
+	return newClient(strings.TrimRight(baseURL, "/"), http.DefaultClient)
+}
+
+// NewUnix creates a new client for the API on the Unix socket at path.
+func NewUnix(path string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}
+
+	return newClient("http://unix", &http.Client{Transport: transport})
+}
+
+// newClient creates a new client and its services.
+func newClient(baseURL string, httpClient *http.Client) *Client {
+	c := &Client{httpClient: httpClient, baseURL: baseURL}
+	c.General = &GeneralService{c}
+	c.Bar = &BarService{c}
+	c.Routines = &RoutinesService{c}
+
+	return c
+}
+
+// SetToken sets the bearer token to send with every request.
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// SetHTTPClient sets the HTTP client that is used to send requests, e.g. to set a timeout.
+func (c *Client) SetHTTPClient(httpClient *http.Client) {
+	if httpClient != nil {
+		c.httpClient = httpClient
+	}
+}
+
+// send sends a request with body (if not nil) encoded as JSON. Error responses are returned as
+// *Error.
+func (c *Client) send(ctx context.Context, method string, path string, body interface{}) (*http.Response, error) {
+	var r *bytes.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	var request *http.Request
+	var err error
+	if r != nil {
+		request, err = http.NewRequestWithContext(ctx, method, c.baseURL+prefix+path, r)
+	} else {
+		request, err = http.NewRequestWithContext(ctx, method, c.baseURL+prefix+path, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if b, err := ioutil.ReadAll(resp.Body); err == nil {
+			if json.Unmarshal(b, apiErr) != nil {
+				apiErr.Message = strings.TrimSpace(string(b))
+			}
+		}
+		return nil, apiErr
+	}
+
+	return resp, nil
+}
+
+// do sends a request and decodes the response into out. If out is a *string, then the response is
+// stored as-is. If out is nil, then the response is discarded.
+func (c *Client) do(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch v := out.(type) {
+	case nil:
+		return nil
+	case *string:
+		*v = string(b)
+		return nil
+	}
+
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(b, out)
+}
+
+// String returns a pointer to s, for setting optional request fields.
+func String(s string) *string {
+	return &s
+}
+
+// Int returns a pointer to i, for setting optional request fields.
+func Int(i int64) *int64 {
+	return &i
+}
+
+// Float returns a pointer to f, for setting optional request fields.
+func Float(f float64) *float64 {
+	return &f
+}
+
+// Bool returns a pointer to b, for setting optional request fields.
+func Bool(b bool) *bool {
+	return &b
+}
+
+// GeneralService handles the endpoints in the "general" table.
+type GeneralService struct {
+	client *Client
+}
+
+// Ping calls GET /ping.
+//
+// Ping the system.
+func (s *GeneralService) Ping(ctx context.Context) (string, error) {
+	var out string
+	err := s.client.do(ctx, "GET", "/ping", nil, &out)
+	return out, err
+}
+
+// Endpoints calls GET /endpoints.
+//
+// Get a list of valid endpoints.
+func (s *GeneralService) Endpoints(ctx context.Context) (*GeneralEndpointsResponse, error) {
+	out := new(GeneralEndpointsResponse)
+	if err := s.client.do(ctx, "GET", "/endpoints", nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BarService handles the endpoints in the "bar" table.
+type BarService struct {
+	client *Client
+}
+
+// Get calls GET /bar.
+//
+// Get the statusbar's current output, as a whole, by region, and by routine.
+func (s *BarService) Get(ctx context.Context) (*BarGetResponse, error) {
+	out := new(BarGetResponse)
+	if err := s.client.do(ctx, "GET", "/bar", nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Stream calls GET /bar/stream.
+//
+// Stream the statusbar's output and routines' state changes as Server-Sent Events. "frame" events
+// carry the same data as GET /bar and are sent whenever the output changes. "state" events carry
+// the routine, name, from, to, message, and time of each state change.
+func (s *BarService) Stream(ctx context.Context) (io.ReadCloser, error) {
+	resp, err := s.client.send(ctx, "GET", "/bar/stream", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// RoutinesService handles the endpoints in the "routines" table.
+type RoutinesService struct {
+	client *Client
+}
+
+// List calls GET /routines.
+//
+// Get a list of information about all routines.
+func (s *RoutinesService) List(ctx context.Context) (*RoutinesListResponse, error) {
+	out := new(RoutinesListResponse)
+	if err := s.client.do(ctx, "GET", "/routines", nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Get calls GET /routines/:routine.
+//
+// Get information about the specified routine.
+func (s *RoutinesService) Get(ctx context.Context, routine string) (RoutinesGetResponse, error) {
+	var out RoutinesGetResponse
+	err := s.client.do(ctx, "GET", "/routines/"+url.PathEscape(routine), nil, &out)
+	return out, err
+}
+
+// History calls GET /routines/:routine/history.
+//
+// Get the recorded metrics of the specified routine, from oldest to newest.
+func (s *RoutinesService) History(ctx context.Context, routine string) (RoutinesHistoryResponse, error) {
+	var out RoutinesHistoryResponse
+	err := s.client.do(ctx, "GET", "/routines/"+url.PathEscape(routine)+"/history", nil, &out)
+	return out, err
+}
+
+// RefreshAll calls PUT /routines.
+//
+// Restart all routines.
+func (s *RoutinesService) RefreshAll(ctx context.Context) error {
+	return s.client.do(ctx, "PUT", "/routines", nil, nil)
+}
+
+// Refresh calls PUT /routines/:routine.
+//
+// Restart the specified routine.
+func (s *RoutinesService) Refresh(ctx context.Context, routine string) error {
+	return s.client.do(ctx, "PUT", "/routines/"+url.PathEscape(routine), nil, nil)
+}
+
+// Update calls PATCH /routines/:routine.
+//
+// Modify the specified routine's settings.
+func (s *RoutinesService) Update(ctx context.Context, routine string, body *RoutinesUpdateRequest) error {
+	return s.client.do(ctx, "PATCH", "/routines/"+url.PathEscape(routine), body, nil)
+}
+
+// StopAll calls DELETE /routines.
+//
+// Stop all routines.
+func (s *RoutinesService) StopAll(ctx context.Context) error {
+	return s.client.do(ctx, "DELETE", "/routines", nil, nil)
+}
+
+// Stop calls DELETE /routines/:routine.
+//
+// Stop the specified routine.
+func (s *RoutinesService) Stop(ctx context.Context, routine string) error {
+	return s.client.do(ctx, "DELETE", "/routines/"+url.PathEscape(routine), nil, nil)
+}
+
+// GeneralEndpointsEndpoint is part of GeneralEndpointsResponse.
+type GeneralEndpointsEndpoint struct {
+	// Endpoint's description
+	Description string `json:"description"`
+
+	// HTTP method, e.g. "GET"
+	Method string `json:"method"`
+
+	// Endpoint's URL, relative to the API's prefix
+	URL string `json:"url"`
+}
+
+// GeneralEndpointsResponse is the response from General.Endpoints.
+type GeneralEndpointsResponse struct {
+	Endpoints []GeneralEndpointsEndpoint `json:"endpoints"`
+}
+
+// BarGetRoutine is part of BarGetResponse.
+type BarGetRoutine struct {
+	// Region the routine is displayed in ("main" or "secondary")
+	Bar string `json:"bar"`
+
+	// Routine's module name
+	Module string `json:"module"`
+
+	// Routine's display name
+	Name string `json:"name"`
+
+	// Routine's output, as displayed
+	Output string `json:"output"`
+}
+
+// BarGetResponse is the response from Bar.Get.
+type BarGetResponse struct {
+	// Full output, as sent to dwm
+	Output   string            `json:"output"`
+	Regions  map[string]string `json:"regions"`
+	Routines []BarGetRoutine   `json:"routines"`
+
+	// Time the output was built, in seconds since the Unix epoch
+	Time float64 `json:"time"`
+}
+
+// RoutinesListRoutine is part of RoutinesListResponse.
+type RoutinesListRoutine struct {
+	// Whether or not routine is currently active
+	Active bool `json:"active"`
+
+	// Number of failed updates since the routine was added
+	ErrorCount float64 `json:"error_count"`
+
+	// Routine's update interval, in seconds
+	Interval float64 `json:"interval"`
+
+	// Time of the routine's last failed update, in seconds since the Unix epoch (0 if never)
+	LastError float64 `json:"last_error"`
+
+	// Time of the routine's last successful update, in seconds since the Unix epoch (0 if never)
+	LastSuccess float64 `json:"last_success"`
+
+	// Routine's name
+	Name string `json:"name"`
+
+	// Routine's schedule, if it does not run on its interval
+	Schedule string `json:"schedule"`
+
+	// Routine's uptime, in seconds
+	Uptime float64 `json:"uptime"`
+}
+
+// RoutinesListResponse is the response from Routines.List.
+type RoutinesListResponse struct {
+	Routines map[string]RoutinesListRoutine `json:"routines"`
+}
+
+// RoutinesGetRoutine is part of RoutinesGetResponse.
+type RoutinesGetRoutine struct {
+	// Whether or not routine is currently active
+	Active bool `json:"active"`
+
+	// Number of failed updates since the routine was added
+	ErrorCount float64 `json:"error_count"`
+
+	// Routine's update interval, in seconds
+	Interval float64 `json:"interval"`
+
+	// Time of the routine's last failed update, in seconds since the Unix epoch (0 if never)
+	LastError float64 `json:"last_error"`
+
+	// Time of the routine's last successful update, in seconds since the Unix epoch (0 if never)
+	LastSuccess float64 `json:"last_success"`
+
+	// Routine's name
+	Name string `json:"name"`
+
+	// Routine's schedule, if it does not run on its interval
+	Schedule string `json:"schedule"`
+
+	// Routine's uptime, in seconds
+	Uptime float64 `json:"uptime"`
+}
+
+// RoutinesGetResponse is the response from Routines.Get.
+type RoutinesGetResponse map[string]RoutinesGetRoutine
+
+// RoutinesHistoryRoutine is part of RoutinesHistoryResponse.
+type RoutinesHistoryRoutine struct {
+	Metrics map[string]float64 `json:"metrics"`
+
+	// Time the sample was recorded, in seconds since the Unix epoch
+	Time float64 `json:"time"`
+}
+
+// RoutinesHistoryResponse is the response from Routines.History.
+type RoutinesHistoryResponse map[string][]RoutinesHistoryRoutine
+
+// RoutinesUpdateRequest is the request body for Routines.Update.
+type RoutinesUpdateRequest struct {
+	// New update interval, in seconds. This replaces the schedule.
+	Interval *int64 `json:"interval,omitempty"`
+
+	// New schedule, e.g. "@aligned 1m" or "0 7 * * *". An empty string switches back to the interval.
+	Schedule *string `json:"schedule,omitempty"`
+}
@@ -0,0 +1,106 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/snhilde/statusbar/v5/apispecs"
+	"github.com/snhilde/statusbar/v5/client"
+	"github.com/snhilde/statusbar/v5/restapi"
+	"github.com/snhilde/statusbar/v5/restapi/clientgen"
+)
+
+func TestGenerated(t *testing.T) {
+	t.Parallel()
+
+	spec, err := restapi.ParseSpec(strings.NewReader(apispecs.RESTV1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := clientgen.Generate(spec, "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile("client.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("client.go is out of date; run go generate")
+	}
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("Authorization")+" "+string(body))
+
+		switch r.Method + " " + r.URL.Path {
+		case "GET /rest/v1/ping":
+			w.Write([]byte("pong"))
+		case "GET /rest/v1/routines":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"routines":{"sbweather":{"name":"Weather","interval":300,"active":true}}}`))
+		case "PUT /rest/v1/routines/sbweather", "PATCH /rest/v1/routines/sbweather":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid routine"}`))
+		}
+	}))
+	defer server.Close()
+
+	c := client.New(server.URL + "/")
+	c.SetToken("secret")
+	ctx := context.Background()
+
+	if pong, err := c.General.Ping(ctx); err != nil || pong != "pong" {
+		t.Errorf("Ping: got %q, %v", pong, err)
+	}
+
+	routines, err := c.Routines.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := routines.Routines["sbweather"]; r.Name != "Weather" || r.Interval != 300 || !r.Active {
+		t.Errorf("List: got %+v", routines)
+	}
+
+	if err := c.Routines.Refresh(ctx, "sbweather"); err != nil {
+		t.Errorf("Refresh: %v", err)
+	}
+
+	if err := c.Routines.Update(ctx, "sbweather", &client.RoutinesUpdateRequest{Interval: client.Int(60)}); err != nil {
+		t.Errorf("Update: %v", err)
+	}
+
+	var apiErr *client.Error
+	err = c.Routines.Stop(ctx, "sb/foo")
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 400 || apiErr.Message != "invalid routine" {
+		t.Errorf("Stop: got %v", err)
+	}
+
+	want := []string{
+		"GET /rest/v1/ping Bearer secret ",
+		"GET /rest/v1/routines Bearer secret ",
+		"PUT /rest/v1/routines/sbweather Bearer secret ",
+		`PATCH /rest/v1/routines/sbweather Bearer secret {"interval":60}`,
+		"DELETE /rest/v1/routines/sb/foo Bearer secret ",
+	}
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got requests:\n%s\nwant:\n%s", strings.Join(requests, "\n"), strings.Join(want, "\n"))
+	}
+}
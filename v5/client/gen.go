@@ -0,0 +1,31 @@
+// +build ignore
+
+// This program generates the client from the REST API v1 specification. Run it with go generate.
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/snhilde/statusbar/v5/apispecs"
+	"github.com/snhilde/statusbar/v5/restapi"
+	"github.com/snhilde/statusbar/v5/restapi/clientgen"
+)
+
+func main() {
+	spec, err := restapi.ParseSpec(strings.NewReader(apispecs.RESTV1))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	src, err := clientgen.Generate(spec, "client")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile("client.go", src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,178 @@
+// This file holds the logic for keeping track of what the bar shows and broadcasting changes to any
+// listeners, like the REST API's bar stream.
+
+package statusbar
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Names of the bar regions.
+const (
+	regionMain      = "main"
+	regionSecondary = "secondary"
+)
+
+// Event names used in the feed.
+const (
+	eventFrame = "frame"
+	eventState = "state"
+)
+
+// feedBuffer is the number of events that can be waiting for each listener. If a listener falls
+// further behind than this, then new events are dropped for it until it catches up.
+const feedBuffer = 16
+
+// frame is a single rendering of the bar.
+type frame struct {
+	// Time the frame was built, in seconds since the Unix epoch.
+	Time int64 `json:"time"`
+
+	// Full output, as sent to dwm.
+	Output string `json:"output"`
+
+	// Output of each region of the bar, keyed by region name ("main" and "secondary").
+	Regions map[string]string `json:"regions"`
+
+	// Output of each routine, in the order they are displayed.
+	Routines []frameRoutine `json:"routines"`
+}
+
+// frameRoutine is a single routine's part of a frame.
+type frameRoutine struct {
+	// Routine's module name, e.g. "sbcpuusage".
+	Module string `json:"module"`
+
+	// Routine's display name.
+	Name string `json:"name"`
+
+	// Region of the bar the routine is displayed in.
+	Bar string `json:"bar"`
+
+	// Routine's output, as it is displayed (without delimiters).
+	Output string `json:"output"`
+}
+
+// event is a single message sent to the feed's listeners.
+type event struct {
+	// Name of the event, e.g. "frame" or "state".
+	name string
+
+	// JSON-encoded data for the event.
+	data []byte
+}
+
+// feed keeps the latest frame and sends events to everyone listening.
+type feed struct {
+	mutex sync.Mutex
+
+	// Most recent frame.
+	last frame
+
+	// Channels of everyone listening.
+	listeners map[chan event]struct{}
+}
+
+// newFeed creates a new feed without any listeners.
+func newFeed() *feed {
+	return &feed{listeners: make(map[chan event]struct{})}
+}
+
+// subscribe adds a listener to the feed. The returned channel receives every event until the
+// listener unsubscribes or the feed is closed, at which point the channel is closed.
+func (f *feed) subscribe() chan event {
+	ch := make(chan event, feedBuffer)
+	if f == nil {
+		close(ch)
+		return ch
+	}
+
+	f.mutex.Lock()
+	f.listeners[ch] = struct{}{}
+	f.mutex.Unlock()
+
+	return ch
+}
+
+// unsubscribe removes a listener from the feed.
+func (f *feed) unsubscribe(ch chan event) {
+	if f == nil {
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.listeners[ch]; ok {
+		delete(f.listeners, ch)
+		close(ch)
+	}
+}
+
+// publish sends an event with the JSON-encoded value to every listener. Listeners that aren't
+// keeping up miss the event.
+func (f *feed) publish(name string, v interface{}) {
+	if f == nil {
+		return
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for ch := range f.listeners {
+		select {
+		case ch <- event{name, b}:
+		default:
+		}
+	}
+}
+
+// setFrame saves the frame as the latest one. If the output changed, then the frame is also sent to
+// every listener.
+func (f *feed) setFrame(fr frame) {
+	if f == nil {
+		return
+	}
+
+	f.mutex.Lock()
+	changed := fr.Output != f.last.Output
+	f.last = fr
+	f.mutex.Unlock()
+
+	if changed {
+		f.publish(eventFrame, fr)
+	}
+}
+
+// frame returns the latest frame.
+func (f *feed) frame() frame {
+	if f == nil {
+		return frame{}
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.last
+}
+
+// close disconnects every listener. The feed can still be subscribed to afterward.
+func (f *feed) close() {
+	if f == nil {
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for ch := range f.listeners {
+		delete(f.listeners, ch)
+		close(ch)
+	}
+}
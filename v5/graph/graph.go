@@ -0,0 +1,180 @@
+// Package graph draws small inline graphs, like sparklines and bars, from a series of numeric
+// samples. It also provides a fixed-size ring buffer for keeping track of the most recent samples.
+//
+// The graphs are built from Unicode block characters so that they can be displayed directly on the
+// statusbar alongside a routine's normal output.
+package graph
+
+import (
+	"strings"
+)
+
+// sparks are the block characters used to draw a sparkline, from lowest to highest.
+var sparks = []rune{'▁', '▂', '▃', '▄', '▅', '▆', '▇', '█'}
+
+// eighths are the partial block characters used to draw the fractional end of a bar, from one
+// eighth to seven eighths.
+var eighths = []rune{'▏', '▎', '▍', '▌', '▋', '▊', '▉'}
+
+// Ring is a fixed-size buffer of samples. After the buffer is full, every new sample overwrites the
+// oldest one.
+type Ring struct {
+	// Samples in the buffer. This is used as a circular buffer.
+	values []float64
+
+	// Index of the oldest sample.
+	start int
+
+	// Number of samples currently in the buffer.
+	count int
+}
+
+// NewRing creates a new ring buffer that holds up to size samples.
+func NewRing(size int) *Ring {
+	if size < 1 {
+		size = 1
+	}
+
+	return &Ring{values: make([]float64, size)}
+}
+
+// Push adds a new sample to the buffer, overwriting the oldest sample if the buffer is full.
+func (r *Ring) Push(value float64) {
+	if r == nil || len(r.values) == 0 {
+		return
+	}
+
+	if r.count < len(r.values) {
+		r.values[(r.start+r.count)%len(r.values)] = value
+		r.count++
+	} else {
+		r.values[r.start] = value
+		r.start = (r.start + 1) % len(r.values)
+	}
+}
+
+// Values returns a copy of the samples in the buffer, ordered from oldest to newest.
+func (r *Ring) Values() []float64 {
+	if r == nil {
+		return nil
+	}
+
+	values := make([]float64, r.count)
+	for i := range values {
+		values[i] = r.values[(r.start+i)%len(r.values)]
+	}
+
+	return values
+}
+
+// Last returns the newest n samples in the buffer, ordered from oldest to newest. If the buffer
+// has fewer than n samples, then all samples are returned.
+func (r *Ring) Last(n int) []float64 {
+	values := r.Values()
+	if n >= 0 && n < len(values) {
+		values = values[len(values)-n:]
+	}
+
+	return values
+}
+
+// Len returns the number of samples currently in the buffer.
+func (r *Ring) Len() int {
+	if r == nil {
+		return 0
+	}
+
+	return r.count
+}
+
+// Cap returns the maximum number of samples the buffer can hold.
+func (r *Ring) Cap() int {
+	if r == nil {
+		return 0
+	}
+
+	return len(r.values)
+}
+
+// Reset removes all samples from the buffer.
+func (r *Ring) Reset() {
+	if r != nil {
+		r.start = 0
+		r.count = 0
+	}
+}
+
+// Sparkline draws one block character for every value, scaled between low and high. If high is not
+// greater than low, then the range is taken from the values themselves.
+func Sparkline(values []float64, low, high float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	if high <= low {
+		low, high = bounds(values)
+	}
+
+	b := new(strings.Builder)
+	for _, v := range values {
+		// Figure out which block to use for this value. A flat series sits on the lowest block.
+		i := 0
+		if high > low {
+			i = int(scale(v, low, high) * float64(len(sparks)-1))
+		}
+		b.WriteRune(sparks[i])
+	}
+
+	return b.String()
+}
+
+// Bar draws a horizontal bar width characters wide that is filled in proportion to where value
+// falls between low and high. Partial cells are drawn with the eighth-block characters, and the
+// unfilled part of the bar is padded with spaces.
+func Bar(value, low, high float64, width int) string {
+	if width < 1 || high <= low {
+		return ""
+	}
+
+	// Work out how many eighths of a cell need to be filled in.
+	filled := int(scale(value, low, high) * float64(width*8))
+	full := filled / 8
+	partial := filled % 8
+
+	b := new(strings.Builder)
+	b.WriteString(strings.Repeat(string(sparks[len(sparks)-1]), full))
+	if partial > 0 {
+		b.WriteRune(eighths[partial-1])
+		full++
+	}
+	b.WriteString(strings.Repeat(" ", width-full))
+
+	return b.String()
+}
+
+// scale returns where value falls between low and high as a fraction from 0 to 1.
+func scale(value, low, high float64) float64 {
+	switch {
+	case value <= low:
+		return 0
+	case value >= high:
+		return 1
+	}
+
+	return (value - low) / (high - low)
+}
+
+// bounds returns the smallest and largest numbers in values.
+func bounds(values []float64) (float64, float64) {
+	low, high := values[0], values[0]
+	for _, v := range values[1:] {
+		if v < low {
+			low = v
+		}
+		if v > high {
+			high = v
+		}
+	}
+
+	return low, high
+}
@@ -0,0 +1,77 @@
+package graph_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/snhilde/statusbar/v5/graph"
+)
+
+func TestRing(t *testing.T) {
+	t.Parallel()
+
+	r := graph.NewRing(3)
+	if r.Len() != 0 || r.Cap() != 3 {
+		t.Fatalf("new ring: len %d, cap %d", r.Len(), r.Cap())
+	}
+
+	for _, v := range []float64{1, 2, 3, 4, 5} {
+		r.Push(v)
+	}
+
+	if got, want := r.Values(), []float64{3, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Values: got %v, want %v", got, want)
+	}
+	if got, want := r.Last(2), []float64{4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Last: got %v, want %v", got, want)
+	}
+
+	r.Reset()
+	if r.Len() != 0 {
+		t.Errorf("Reset: len %d", r.Len())
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		values    []float64
+		low, high float64
+		want      string
+	}{
+		{nil, 0, 100, ""},
+		{[]float64{0, 50, 100}, 0, 100, "▁▄█"},
+		{[]float64{-10, 200}, 0, 100, "▁█"},
+		{[]float64{1, 2, 3}, 0, 0, "▁▄█"},
+		{[]float64{7, 7}, 0, 0, "▁▁"},
+	}
+
+	for _, test := range tests {
+		if got := graph.Sparkline(test.values, test.low, test.high); got != test.want {
+			t.Errorf("Sparkline(%v, %v, %v): got %q, want %q", test.values, test.low, test.high, got, test.want)
+		}
+	}
+}
+
+func TestBar(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value float64
+		width int
+		want  string
+	}{
+		{0, 4, "    "},
+		{50, 4, "██  "},
+		{100, 4, "████"},
+		{25, 1, "▎"},
+		{50, 0, ""},
+	}
+
+	for _, test := range tests {
+		if got := graph.Bar(test.value, 0, 100, test.width); got != test.want {
+			t.Errorf("Bar(%v, %d): got %q, want %q", test.value, test.width, got, test.want)
+		}
+	}
+}
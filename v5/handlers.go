@@ -4,14 +4,15 @@ package statusbar
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"os"
+	"strings"
+	"time"
 
 	"github.com/snhilde/statusbar/v5/restapi"
+	"github.com/snhilde/statusbar/v5/schedule"
 )
 
 // apiHandler is a wrapper object for convenience reasons: in order for the restapi package to be
@@ -36,6 +37,20 @@ type routineInfo struct {
 
 	// Whether or not the routine is currently active.
 	Active bool `json:"active"`
+
+	// Schedule the routine runs on, if it doesn't run on its interval.
+	Schedule string `json:"schedule,omitempty"`
+
+	// Time of the last successful update, in seconds since the Unix epoch. If the routine has never
+	// updated successfully, then this is 0.
+	LastSuccess int64 `json:"last_success"`
+
+	// Time of the last failed update, in seconds since the Unix epoch. If the routine has never
+	// failed, then this is 0.
+	LastError int64 `json:"last_error"`
+
+	// Number of failed updates since the routine was added.
+	ErrorCount int `json:"error_count"`
 }
 
 // HandleGetPing responds to a ping request with "pong".
@@ -44,20 +59,23 @@ func (a apiHandler) HandleGetPing(endpoint restapi.Endpoint, params restapi.Para
 	return 200, "pong"
 }
 
-// HandleGetEndpoints returns a JSON object of all possible v1 endpoints and their descriptions.
+// historyPoint holds a single sample of a routine's metrics that is returned for history queries.
+type historyPoint struct {
+	// Time the sample was recorded, in seconds since the Unix epoch.
+	Time int64 `json:"time"`
+
+	// Routine's metrics at that time, keyed by name.
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// HandleGetEndpoints returns a JSON object of all possible endpoints for this version of the API
+// and their descriptions.
 // endpoint: GET /endpoints
 func (a apiHandler) HandleGetEndpoints(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
-	// Open up our spec file for reading.
-	file, err := os.Open("api_specs/restv1.json")
-	if err != nil {
-		return 500, encodePair("error", err.Error())
-	}
-
-	// Unmarshal JSON in file.
-	spec := restapi.RestSpec{}
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&spec); err != nil && !errors.Is(err, io.EOF) {
-		return 500, encodePair("error", err.Error())
+	// Find the spec that this request came in on.
+	spec, ok := a.findSpec(request.URL.Path)
+	if !ok {
+		return 500, encodePair("error", "missing API specification")
 	}
 
 	// Go through the spec and read all the specified endpoints.
@@ -76,11 +94,70 @@ func (a apiHandler) HandleGetEndpoints(endpoint restapi.Endpoint, params restapi
 	return 200, encodePair("endpoints", endpoints)
 }
 
+// HandleGetBar responds with what the statusbar is currently showing, as a whole, by region, and by
+// routine.
+// endpoint: GET /bar
+func (a apiHandler) HandleGetBar(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
+	b, err := json.Marshal(a.feed.frame())
+	if err != nil {
+		return 500, encodePair("error", err.Error())
+	}
+
+	return 200, string(b)
+}
+
+// HandleGetBarStream streams every new frame of the statusbar and every routine state change to the
+// client as Server-Sent Events. The current frame is sent right away. Frames are sent as "frame"
+// events with the same data as GET /bar, and state changes are sent as "state" events.
+// endpoint: GET /bar/stream
+func (a apiHandler) HandleGetBarStream(endpoint restapi.Endpoint, params restapi.Params, w http.ResponseWriter, request *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, encodePair("error", "streaming not supported"), 500)
+		return
+	}
+
+	ch := a.feed.subscribe()
+	defer a.feed.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(200)
+
+	// Start with the current frame.
+	if b, err := json.Marshal(a.feed.frame()); err == nil {
+		writeEvent(w, eventFrame, b)
+		flusher.Flush()
+	}
+
+	// Send a comment every so often so that proxies don't close the connection while the bar is
+	// quiet.
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				// The feed was closed.
+				return
+			}
+			writeEvent(w, e.name, e.data)
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
 // HandleGetRoutineAll responds with information about all the routines (active and inactive).
 // endpoint: GET /routines
 func (a apiHandler) HandleGetRoutineAll(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
 	infos := make(map[string]routineInfo)
-	for _, routine := range a.routines {
+	for _, routine := range a.routineList() {
 		name := routine.moduleName()
 		info := getRoutineInfo(routine)
 		infos[name] = info
@@ -92,7 +169,7 @@ func (a apiHandler) HandleGetRoutineAll(endpoint restapi.Endpoint, params restap
 // HandleGetRoutine responds with information about the specified routine.
 // endpoint: GET /routines/:routine
 func (a apiHandler) HandleGetRoutine(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
-	routine, err := getRoutine(a.routines, params["routine"])
+	routine, err := getRoutine(a.routineList(), params["routine"])
 	if err != nil {
 		return 400, encodePair("error", err.Error())
 	}
@@ -100,10 +177,28 @@ func (a apiHandler) HandleGetRoutine(endpoint restapi.Endpoint, params restapi.P
 	return 200, encodePair(routine.moduleName(), getRoutineInfo(routine))
 }
 
+// HandleGetRoutineHistory responds with the recorded metrics of the specified routine, ordered from
+// oldest to newest. If the routine does not report any metrics, then the list is empty.
+// endpoint: GET /routines/:routine/history
+func (a apiHandler) HandleGetRoutineHistory(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
+	routine, err := getRoutine(a.routineList(), params["routine"])
+	if err != nil {
+		return 400, encodePair("error", err.Error())
+	}
+
+	samples := routine.history.list()
+	points := make([]historyPoint, 0, len(samples))
+	for _, s := range samples {
+		points = append(points, historyPoint{Time: s.time.Unix(), Metrics: s.metrics})
+	}
+
+	return 200, encodePair(routine.moduleName(), points)
+}
+
 // HandlePutRoutineAll restarts all active routines.
 // endpoint: PUT /routines
 func (a apiHandler) HandlePutRoutineAll(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
-	for _, routine := range a.routines {
+	for _, routine := range a.routineList() {
 		if routine.isActive() {
 			routine.update()
 		}
@@ -115,7 +210,7 @@ func (a apiHandler) HandlePutRoutineAll(endpoint restapi.Endpoint, params restap
 // HandlePutRoutine restarts the specified routine.
 // endpoint: PUT /routines/:routine
 func (a apiHandler) HandlePutRoutine(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
-	routine, err := getRoutine(a.routines, params["routine"])
+	routine, err := getRoutine(a.routineList(), params["routine"])
 	if err != nil {
 		return 400, encodePair("error", err.Error())
 	}
@@ -127,11 +222,12 @@ func (a apiHandler) HandlePutRoutine(endpoint restapi.Endpoint, params restapi.P
 	return 204, ""
 }
 
-// HandlePatchRoutine updates the specified routine's data. Currently, this only updates the
-// interval time.
+// HandlePatchRoutine updates the specified routine's data. Currently, this updates the interval
+// time and the schedule. Setting the interval switches the routine back to running on its interval,
+// and setting the schedule to an empty string does the same.
 // endpoint: PATCH /routines/:routine
 func (a apiHandler) HandlePatchRoutine(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
-	routine, err := getRoutine(a.routines, params["routine"])
+	routine, err := getRoutine(a.routineList(), params["routine"])
 	if err != nil {
 		return 400, encodePair("error", err.Error())
 	}
@@ -145,14 +241,40 @@ func (a apiHandler) HandlePatchRoutine(endpoint restapi.Endpoint, params restapi
 		return 400, encodePair("error", "missing request body")
 	}
 
-	// Set the default interval to -1 so we know if a new interval was passed in or not.
-	info := routineInfo{Interval: -1}
-	if err := json.Unmarshal(body, &info); err != nil {
+	// Use pointers so we know which fields were passed in. The engine has already checked the
+	// field types against the spec.
+	changes := struct {
+		Interval *int    `json:"interval"`
+		Schedule *string `json:"schedule"`
+	}{}
+	if err := json.Unmarshal(body, &changes); err != nil {
 		return 400, encodePair("error", err.Error())
 	}
 
-	if info.Interval >= 0 {
-		routine.setInterval(info.Interval)
+	// Make sure the new schedule is good before we change anything.
+	var sched schedule.Schedule
+	if changes.Schedule != nil && *changes.Schedule != "" {
+		if sched, err = schedule.Parse(*changes.Schedule); err != nil {
+			return 400, encodePair("error", err.Error())
+		}
+	}
+
+	// Without a schedule, the routine needs an interval to keep running on.
+	interval := routine.interval()
+	if changes.Interval != nil && *changes.Interval >= 0 {
+		interval = *changes.Interval
+	}
+	if changes.Schedule != nil && *changes.Schedule == "" && interval < 1 {
+		return 400, encodePair("error", "interval required to clear schedule")
+	}
+
+	if changes.Interval != nil && *changes.Interval >= 0 {
+		routine.setInterval(*changes.Interval)
+		routine.setSchedule(nil)
+	}
+
+	if changes.Schedule != nil {
+		routine.setSchedule(sched)
 	}
 
 	// Let's also trigger an update in case the interval time is now up.
@@ -166,7 +288,7 @@ func (a apiHandler) HandlePatchRoutine(endpoint restapi.Endpoint, params restapi
 // HandleDeleteRoutineAll stops all routines (and therefore the statusbar and API engine).
 // endpoint: DELETE /routines
 func (a apiHandler) HandleDeleteRoutineAll(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
-	for _, routine := range a.routines {
+	for _, routine := range a.routineList() {
 		if routine.isActive() {
 			if !routine.stop(5) {
 				return 500, encodePair("error", "failure")
@@ -180,7 +302,7 @@ func (a apiHandler) HandleDeleteRoutineAll(endpoint restapi.Endpoint, params res
 // HandleDeleteRoutine stops the specified routine.
 // endpoint: DELETE /routines/:routine
 func (a apiHandler) HandleDeleteRoutine(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
-	routine, err := getRoutine(a.routines, params["routine"])
+	routine, err := getRoutine(a.routineList(), params["routine"])
 	if err != nil {
 		return 400, encodePair("error", err.Error())
 	}
@@ -218,12 +340,48 @@ func encodePair(key string, value interface{}) string {
 // getRoutineInfo returns the routine's information.
 func getRoutineInfo(r *routine) routineInfo {
 	if r != nil {
+		lastSuccess, lastError, _, errorCount := r.results()
 		return routineInfo{
-			Name:     r.displayName(),
-			Uptime:   r.uptime(),
-			Interval: r.interval(),
-			Active:   r.isActive(),
+			Name:        r.displayName(),
+			Uptime:      r.uptime(),
+			Interval:    r.interval(),
+			Active:      r.isActive(),
+			Schedule:    scheduleSpec(r.getSchedule()),
+			LastSuccess: unixTime(lastSuccess),
+			LastError:   unixTime(lastError),
+			ErrorCount:  errorCount,
 		}
 	}
 	return routineInfo{}
 }
+
+// unixTime returns t in seconds since the Unix epoch, or 0 if t is the zero time.
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// scheduleSpec returns the spec of the schedule, or an empty string if there is no schedule.
+func scheduleSpec(sched schedule.Schedule) string {
+	if sched == nil {
+		return ""
+	}
+	return sched.String()
+}
+
+// findSpec finds the REST API specification that serves the path.
+func (a apiHandler) findSpec(path string) (restapi.RestSpec, bool) {
+	for _, spec := range a.restEngine.Specs() {
+		if strings.HasPrefix(path, spec.Prefix+"/") {
+			return spec, true
+		}
+	}
+	return restapi.RestSpec{}, false
+}
+
+// writeEvent writes a single Server-Sent Event.
+func writeEvent(w io.Writer, name string, data []byte) {
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+}
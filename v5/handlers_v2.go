@@ -0,0 +1,530 @@
+// This file contains the callbacks that handle the REST API v2 endpoints. Endpoints that are the
+// same in both versions (like /ping and /bar) are handled by the v1 callbacks.
+
+package statusbar
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/snhilde/statusbar/v5/restapi"
+	"github.com/snhilde/statusbar/v5/schedule"
+)
+
+// colorPattern matches the colors that can be set on a routine, e.g. "#FF0000" or "#F00".
+var colorPattern = regexp.MustCompile(`^#([[:xdigit:]]{3}|[[:xdigit:]]{6})$`)
+
+// apiV2Handler wraps the statusbar object for the v2 callbacks. It embeds the v1 handler so that
+// the endpoints that didn't change between versions can use the same callbacks.
+type apiV2Handler struct {
+	apiHandler
+}
+
+// routineResource is the full representation of a routine in v2.
+type routineResource struct {
+	// Unique identifier of the routine. This is the module name, with a number added if more than
+	// one routine uses the same module.
+	ID string `json:"id"`
+
+	// Routine's module name.
+	Module string `json:"module"`
+
+	// Routine's display name.
+	Name string `json:"name"`
+
+	// Routine's current state ("normal", "warning", "error", "failed", or "stopped"). This is empty
+	// until the routine runs for the first time.
+	State string `json:"state"`
+
+	// Whether or not the routine is running.
+	Active bool `json:"active"`
+
+	// Whether or not the routine's scheduled updates are paused.
+	Paused bool `json:"paused"`
+
+	// Routine's last good output.
+	Output string `json:"output"`
+
+	// Error from the routine's last failed update.
+	LastErrorMessage string `json:"last_error_message"`
+
+	// Number of failed updates since the routine was added.
+	ErrorCount int `json:"error_count"`
+
+	// Time between updates, in seconds.
+	Interval int `json:"interval"`
+
+	// Schedule the routine runs on, if it doesn't run on its interval.
+	Schedule string `json:"schedule"`
+
+	// How long the routine has been running, in seconds.
+	Uptime int `json:"uptime"`
+
+	// Time the routine was started, in RFC 3339 format. This is empty if the routine hasn't started.
+	StartedAt string `json:"started_at"`
+
+	// Time of the last successful update, in RFC 3339 format. This is empty if there hasn't been one.
+	LastSuccessAt string `json:"last_success_at"`
+
+	// Time of the last failed update, in RFC 3339 format. This is empty if there hasn't been one.
+	LastErrorAt string `json:"last_error_at"`
+
+	// Routine's position within its region of the bar, starting at 0.
+	Position int `json:"position"`
+
+	// Region of the bar the routine is displayed in ("main" or "secondary").
+	Bar string `json:"bar"`
+
+	// Colors the routine is displayed in, if they are overridden.
+	Colors routineColors `json:"colors"`
+}
+
+// routineColors holds the colors a routine is displayed in. Empty colors mean that the routine's
+// own colors are used.
+type routineColors struct {
+	Foreground string `json:"foreground"`
+	Background string `json:"background"`
+}
+
+// HandleGetRoutineAll responds with the full resource of every routine, in display order (main bar
+// first).
+// endpoint: GET /routines
+func (a apiV2Handler) HandleGetRoutineAll(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
+	resources := make([]routineResource, 0)
+	for _, bar := range []string{regionMain, regionSecondary} {
+		for _, r := range a.routineList() {
+			if r.getBar() == bar {
+				resources = append(resources, a.resource(r))
+			}
+		}
+	}
+
+	return 200, encodePair("routines", resources)
+}
+
+// HandleGetRoutine responds with the full resource of the specified routine.
+// endpoint: GET /routines/:routine
+func (a apiV2Handler) HandleGetRoutine(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
+	r := a.findRoutine(params["routine"])
+	if r == nil {
+		return errorV2(404, "not_found", "routine not found: "+params["routine"])
+	}
+
+	return a.encodeResource(200, r)
+}
+
+// HandleGetRoutineHistory responds with the recorded metrics of the specified routine, ordered from
+// oldest to newest.
+// endpoint: GET /routines/:routine/history
+func (a apiV2Handler) HandleGetRoutineHistory(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
+	r := a.findRoutine(params["routine"])
+	if r == nil {
+		return errorV2(404, "not_found", "routine not found: "+params["routine"])
+	}
+
+	samples := r.history.list()
+	points := make([]historyPoint, 0, len(samples))
+	for _, s := range samples {
+		points = append(points, historyPoint{Time: s.time.Unix(), Metrics: s.metrics})
+	}
+
+	return 200, encodePair("history", points)
+}
+
+// HandlePatchRoutine changes the specified routine's settings and responds with its updated
+// resource. Every field is optional. The changes are checked before any are made, so either all of
+// them are made or none are.
+// endpoint: PATCH /routines/:routine
+func (a apiV2Handler) HandlePatchRoutine(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
+	r := a.findRoutine(params["routine"])
+	if r == nil {
+		return errorV2(404, "not_found", "routine not found: "+params["routine"])
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		return errorV2(400, "invalid_request", err.Error())
+	}
+	if len(body) == 0 {
+		return errorV2(400, "invalid_request", "missing request body")
+	}
+
+	patch := routinePatch{}
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return errorV2(400, "invalid_request", err.Error())
+	}
+
+	// Check everything before we change anything.
+	if code, msg := patch.check(r); code != 0 {
+		return code, msg
+	}
+	a.applyPatch(r, patch)
+
+	// Trigger an update in case the interval or schedule means it's time to run.
+	if (patch.Interval != nil || patch.Schedule != nil) && r.isActive() {
+		r.update()
+	}
+
+	return a.encodeResource(200, r)
+}
+
+// HandleDeleteRoutine stops the specified routine.
+// endpoint: DELETE /routines/:routine
+func (a apiV2Handler) HandleDeleteRoutine(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
+	r := a.findRoutine(params["routine"])
+	if r == nil {
+		return errorV2(404, "not_found", "routine not found: "+params["routine"])
+	}
+
+	if !r.stop(5) {
+		return errorV2(500, "internal_error", "failed to stop routine")
+	}
+
+	return 204, ""
+}
+
+// HandlePostRoutineRefresh makes the specified routine update right away, even if it is paused.
+// endpoint: POST /routines/:routine/refresh
+func (a apiV2Handler) HandlePostRoutineRefresh(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
+	r := a.findRoutine(params["routine"])
+	if r == nil {
+		return errorV2(404, "not_found", "routine not found: "+params["routine"])
+	}
+
+	if !r.isActive() {
+		return errorV2(409, "not_running", "routine is not running")
+	}
+
+	// Don't block if an update is already waiting to happen.
+	select {
+	case r.updateChan <- struct{}{}:
+	default:
+	}
+
+	return a.encodeResource(202, r)
+}
+
+// HandlePostRoutinePause pauses the specified routine's scheduled updates. The routine keeps showing
+// its last output until it is resumed.
+// endpoint: POST /routines/:routine/pause
+func (a apiV2Handler) HandlePostRoutinePause(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
+	r := a.findRoutine(params["routine"])
+	if r == nil {
+		return errorV2(404, "not_found", "routine not found: "+params["routine"])
+	}
+
+	r.setPaused(true)
+
+	return a.encodeResource(200, r)
+}
+
+// HandlePostRoutineResume resumes the specified routine's scheduled updates and updates it right
+// away.
+// endpoint: POST /routines/:routine/resume
+func (a apiV2Handler) HandlePostRoutineResume(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
+	r := a.findRoutine(params["routine"])
+	if r == nil {
+		return errorV2(404, "not_found", "routine not found: "+params["routine"])
+	}
+
+	if r.isPaused() {
+		r.setPaused(false)
+		if r.isActive() {
+			select {
+			case r.updateChan <- struct{}{}:
+			default:
+			}
+		}
+	}
+
+	return a.encodeResource(200, r)
+}
+
+// HandlePostRoutineRestart stops the specified routine (if it is running) and starts it again.
+// This can be used to bring back a routine that was stopped.
+// endpoint: POST /routines/:routine/restart
+func (a apiV2Handler) HandlePostRoutineRestart(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
+	r := a.findRoutine(params["routine"])
+	if r == nil {
+		return errorV2(404, "not_found", "routine not found: "+params["routine"])
+	}
+
+	if err := a.restartRoutine(r); err != nil {
+		return errorV2(409, "not_running", err.Error())
+	}
+
+	return a.encodeResource(202, r)
+}
+
+// healthResource is the state of the REST API's listeners.
+type healthResource struct {
+	// Whether or not the API is serving requests over TCP.
+	Ready bool `json:"ready"`
+
+	// Address the API is listening on over TCP, or an empty string if it isn't.
+	Address string `json:"address"`
+
+	// Paths of the Unix sockets the API is listening on.
+	Sockets []string `json:"sockets"`
+
+	// Error that stopped the TCP listener, if it stopped on its own.
+	Error string `json:"error"`
+}
+
+// HandleGetHealth responds with the state of the REST API's listeners. This is mostly useful over a
+// Unix socket, to check on the TCP listener.
+// endpoint: GET /health
+func (a apiV2Handler) HandleGetHealth(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
+	return a.encodeHealth()
+}
+
+// HandlePutListener moves the REST API's TCP listener to a new host and/or port. Anything that isn't
+// passed in stays the same.
+// endpoint: PUT /listener
+func (a apiV2Handler) HandlePutListener(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		return errorV2(400, "invalid_request", err.Error())
+	}
+	if len(body) == 0 {
+		return errorV2(400, "invalid_request", "missing request body")
+	}
+
+	changes := struct {
+		Host *string `json:"host"`
+		Port *int    `json:"port"`
+	}{}
+	if err := json.Unmarshal(body, &changes); err != nil {
+		return errorV2(400, "invalid_request", err.Error())
+	}
+
+	host, port := a.listenerAddress()
+	if changes.Host != nil {
+		if *changes.Host == "" {
+			return errorV2(400, "invalid_value", "host: must not be empty")
+		}
+		host = *changes.Host
+	}
+	if changes.Port != nil {
+		if *changes.Port < 1 || *changes.Port > 65535 {
+			return errorV2(400, "invalid_value", "port: must be from 1 to 65535")
+		}
+		port = *changes.Port
+	}
+	if port == 0 {
+		return errorV2(400, "invalid_value", "port: missing port")
+	}
+
+	if err := a.RebindRESTAPI(host, port); err != nil {
+		return errorV2(409, "address_unavailable", err.Error())
+	}
+
+	return a.encodeHealth()
+}
+
+// listenerAddress returns the host and port that the REST API is listening on over TCP, or that it
+// was set to listen on if it isn't.
+func (a apiV2Handler) listenerAddress() (string, int) {
+	if address := a.restEngine.Health().Address; address != "" {
+		if host, port, err := net.SplitHostPort(address); err == nil {
+			if p, err := strconv.Atoi(port); err == nil {
+				return host, p
+			}
+		}
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	host := a.restHost
+	if host == "" {
+		// This is what the REST API listens on by default.
+		host = "127.0.0.1"
+	}
+
+	return host, a.restPort
+}
+
+// encodeHealth responds with the state of the REST API's listeners.
+func (a apiV2Handler) encodeHealth() (int, string) {
+	health := a.restEngine.Health()
+	resource := healthResource{
+		Ready:   health.Ready,
+		Address: health.Address,
+		Sockets: health.Sockets,
+	}
+	if health.Err != nil {
+		resource.Error = health.Err.Error()
+	}
+
+	b, err := json.Marshal(resource)
+	if err != nil {
+		return errorV2(500, "internal_error", err.Error())
+	}
+
+	return 200, string(b)
+}
+
+// resource builds the full resource for the routine.
+func (a apiV2Handler) resource(r *routine) routineResource {
+	output, errMsg := r.lastOutput()
+	lastSuccess, lastError, _, errorCount := r.results()
+	fg, bg := r.colors()
+
+	started := time.Time{}
+	if r.isActive() {
+		started = r.started()
+	}
+
+	return routineResource{
+		ID:               r.id,
+		Module:           r.moduleName(),
+		Name:             r.displayName(),
+		State:            r.currentState(),
+		Active:           r.isActive(),
+		Paused:           r.isPaused(),
+		Output:           output,
+		LastErrorMessage: errMsg,
+		ErrorCount:       errorCount,
+		Interval:         r.interval(),
+		Schedule:         scheduleSpec(r.getSchedule()),
+		Uptime:           r.uptime(),
+		StartedAt:        rfc3339(started),
+		LastSuccessAt:    rfc3339(lastSuccess),
+		LastErrorAt:      rfc3339(lastError),
+		Position:         a.position(r),
+		Bar:              r.getBar(),
+		Colors:           routineColors{Foreground: fg, Background: bg},
+	}
+}
+
+// encodeResource responds with the routine's resource and the HTTP code.
+func (a apiV2Handler) encodeResource(code int, r *routine) (int, string) {
+	b, err := json.Marshal(a.resource(r))
+	if err != nil {
+		return errorV2(500, "internal_error", err.Error())
+	}
+
+	return code, string(b)
+}
+
+// routinePatch holds the changes requested for a routine in PATCH /routines/:routine. The fields
+// are pointers so we know which ones were passed in. The engine has already checked the field types
+// against the spec.
+type routinePatch struct {
+	Name     *string `json:"name"`
+	Interval *int    `json:"interval"`
+	Schedule *string `json:"schedule"`
+	Position *int    `json:"position"`
+	Bar      *string `json:"bar"`
+	Colors   *struct {
+		Foreground *string `json:"foreground"`
+		Background *string `json:"background"`
+	} `json:"colors"`
+
+	// Schedule parsed from the Schedule field, or nil if the schedule is being cleared.
+	sched schedule.Schedule
+
+	// Routine's colors after the change.
+	fg string
+	bg string
+}
+
+// check makes sure that every change is valid for the routine and fills in the parsed values. If a
+// change is not valid, then this returns the error response. Otherwise, it returns a code of 0.
+func (p *routinePatch) check(r *routine) (int, string) {
+	if p.Schedule != nil && *p.Schedule != "" {
+		sched, err := schedule.Parse(*p.Schedule)
+		if err != nil {
+			return errorV2(400, "invalid_value", "schedule: "+err.Error())
+		}
+		p.sched = sched
+	}
+	if p.Interval != nil && *p.Interval < 1 {
+		return errorV2(400, "invalid_value", "interval: must be at least 1")
+	}
+	clearing := p.Schedule != nil && *p.Schedule == ""
+	if clearing && p.Interval == nil && r.interval() < 1 {
+		return errorV2(400, "invalid_value", "schedule: an interval is required to clear the schedule")
+	}
+	if p.Position != nil && *p.Position < 0 {
+		return errorV2(400, "invalid_value", "position: must not be negative")
+	}
+	if p.Bar != nil && *p.Bar != regionMain && *p.Bar != regionSecondary {
+		msg := fmt.Sprintf("bar: must be %q or %q", regionMain, regionSecondary)
+		return errorV2(400, "invalid_value", msg)
+	}
+
+	p.fg, p.bg = r.colors()
+	if p.Colors != nil {
+		if c := p.Colors.Foreground; c != nil {
+			if *c != "" && !colorPattern.MatchString(*c) {
+				return errorV2(400, "invalid_value", "colors.foreground: must be a color like \"#FF0000\"")
+			}
+			p.fg = *c
+		}
+		if c := p.Colors.Background; c != nil {
+			if *c != "" && !colorPattern.MatchString(*c) {
+				return errorV2(400, "invalid_value", "colors.background: must be a color like \"#FF0000\"")
+			}
+			p.bg = *c
+		}
+	}
+
+	return 0, ""
+}
+
+// applyPatch makes the changes in the patch, which must have already been checked.
+func (a apiV2Handler) applyPatch(r *routine, p routinePatch) {
+	if p.Name != nil {
+		r.setLabel(*p.Name)
+	}
+	if p.Interval != nil {
+		r.setInterval(*p.Interval)
+		r.setSchedule(nil)
+	}
+	if p.Schedule != nil {
+		r.setSchedule(p.sched)
+	}
+	if p.Position != nil || p.Bar != nil {
+		bar := r.getBar()
+		if p.Bar != nil {
+			bar = *p.Bar
+		}
+		position := a.position(r)
+		if p.Position != nil {
+			position = *p.Position
+		} else if bar != r.getBar() {
+			// Moving to the other region without a position puts the routine at the end.
+			position = len(a.routineList())
+		}
+		a.moveRoutine(r, bar, position)
+	}
+	r.setColors(p.fg, p.bg)
+}
+
+// errorV2 builds a v2 error response. Every v2 error has the same envelope as the errors that the
+// REST engine sends itself: a human-readable message in "error" and a machine-readable code in
+// "code".
+func errorV2(status int, code string, message string) (int, string) {
+	b, _ := json.Marshal(struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}{message, code})
+
+	return status, string(b)
+}
+
+// rfc3339 formats t in RFC 3339 format, or returns an empty string if t is the zero time.
+func rfc3339(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
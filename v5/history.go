@@ -0,0 +1,102 @@
+// This file holds the logic for keeping a history of a routine's metrics.
+
+package statusbar
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/snhilde/statusbar/v5/graph"
+)
+
+// sample is a snapshot of a routine's metrics at a point in time.
+type sample struct {
+	// Time the metrics were recorded.
+	time time.Time
+
+	// Metrics as reported by the routine, keyed by name.
+	metrics map[string]float64
+}
+
+// history is a fixed-size record of a routine's most recent samples. After it is full, every new
+// sample overwrites the oldest one. It is safe for concurrent use.
+type history struct {
+	mutex sync.Mutex
+
+	// Times of the samples, in seconds since the Unix epoch.
+	times *graph.Ring
+
+	// Values of each metric, keyed by name. Every ring lines up with times, and samples that didn't
+	// have a metric hold NaN in that metric's ring.
+	metrics map[string]*graph.Ring
+}
+
+// newHistory returns a new history that can hold up to size samples.
+func newHistory(size int) *history {
+	return &history{
+		times:   graph.NewRing(size),
+		metrics: make(map[string]*graph.Ring),
+	}
+}
+
+// add records the metrics in the history, overwriting the oldest sample if the history is full.
+func (h *history) add(t time.Time, metrics map[string]float64) {
+	if h == nil || len(metrics) == 0 {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.times.Push(float64(t.UnixNano()) / 1e9)
+
+	for name, ring := range h.metrics {
+		if _, ok := metrics[name]; !ok {
+			ring.Push(math.NaN())
+		}
+	}
+
+	for name, value := range metrics {
+		ring, ok := h.metrics[name]
+		if !ok {
+			// Fill in the earlier samples that didn't have this metric.
+			ring = graph.NewRing(h.times.Cap())
+			for i := 1; i < h.times.Len(); i++ {
+				ring.Push(math.NaN())
+			}
+			h.metrics[name] = ring
+		}
+		ring.Push(value)
+	}
+}
+
+// list returns a copy of all samples in the history, ordered from oldest to newest.
+func (h *history) list() []sample {
+	if h == nil {
+		return nil
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	times := h.times.Values()
+	samples := make([]sample, len(times))
+	for i, t := range times {
+		sec := math.Floor(t)
+		samples[i] = sample{
+			time:    time.Unix(int64(sec), int64((t-sec)*1e9)),
+			metrics: make(map[string]float64),
+		}
+	}
+
+	for name, ring := range h.metrics {
+		for i, value := range ring.Values() {
+			if !math.IsNaN(value) {
+				samples[i].metrics[name] = value
+			}
+		}
+	}
+
+	return samples
+}
@@ -0,0 +1,130 @@
+// This file contains the logic for authenticating and authorizing requests.
+
+package restapi
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scope is the level of access that a token grants or that an endpoint requires.
+type Scope string
+
+const (
+	// ScopeRead allows access to endpoints that only read data.
+	ScopeRead Scope = "read"
+
+	// ScopeWrite allows access to all endpoints, including those that change data.
+	ScopeWrite Scope = "write"
+)
+
+// token is a bearer token that clients can use to access the API.
+type token struct {
+	value string
+	scope Scope
+}
+
+// AddToken adds a bearer token that clients can use to access the API. Once at least one token is
+// added, every request over TCP must send a valid token in the Authorization header
+// ("Authorization: Bearer <token>"). Requests without a valid token receive a 401 response, and
+// requests with a token whose scope is too narrow for the endpoint receive a 403 response. A token
+// with ScopeWrite can access every endpoint, and a token with ScopeRead can access only the
+// endpoints that require ScopeRead. See Endpoint for how each endpoint's scope is determined.
+func (e *Engine) AddToken(value string, scope Scope) error {
+	if e == nil {
+		return fmt.Errorf("invalid Engine")
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return fmt.Errorf("empty token")
+	}
+
+	if scope != ScopeRead && scope != ScopeWrite {
+		return fmt.Errorf("invalid scope: %s", scope)
+	}
+
+	e.tokens = append(e.tokens, token{value, scope})
+
+	return nil
+}
+
+// ReadTokenFile reads a token from the file at path. Leading and trailing whitespace is removed.
+func ReadTokenFile(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	value := strings.TrimSpace(string(b))
+	if value == "" {
+		return "", fmt.Errorf("%s: empty token", path)
+	}
+
+	return value, nil
+}
+
+// authorize checks that the request carries a token that grants the scope. If it does not, then
+// this aborts the request with the appropriate error response and returns false. If no tokens have
+// been added to the engine, or if the request came in over a Unix socket (which is protected by its
+// file permissions), then every request is allowed.
+func (e *Engine) authorize(c *gin.Context, scope Scope) bool {
+	if len(e.tokens) == 0 || isUnixConn(c) {
+		return true
+	}
+
+	value := bearerToken(c.GetHeader("Authorization"))
+	granted := Scope("")
+	for _, t := range e.tokens {
+		if subtle.ConstantTimeCompare([]byte(value), []byte(t.value)) == 1 {
+			granted = t.scope
+			break
+		}
+	}
+
+	switch {
+	case granted == "":
+		c.Header("WWW-Authenticate", "Bearer")
+		resp := errorResponse{Error: "missing or invalid token", Code: "unauthorized"}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, resp)
+		return false
+	case granted == ScopeRead && scope != ScopeRead:
+		resp := errorResponse{Error: "token does not have " + string(scope) + " access", Code: "forbidden"}
+		c.AbortWithStatusJSON(http.StatusForbidden, resp)
+		return false
+	}
+
+	return true
+}
+
+// bearerToken returns the token from an Authorization header value like "Bearer <token>", or an
+// empty string if the header doesn't hold a bearer token. The scheme is not case-sensitive.
+func bearerToken(header string) string {
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+
+	return strings.TrimSpace(header[len(prefix):])
+}
+
+// requiredScope returns the scope that is needed to access the endpoint. If the endpoint does not
+// specify one, then GET, HEAD, and OPTIONS requests need ScopeRead, and all other requests need
+// ScopeWrite.
+func (ep Endpoint) requiredScope() Scope {
+	if ep.Scope != "" {
+		return ep.Scope
+	}
+
+	switch strings.ToUpper(ep.Method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ScopeRead
+	}
+
+	return ScopeWrite
+}
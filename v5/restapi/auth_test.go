@@ -0,0 +1,89 @@
+package restapi_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/snhilde/statusbar/v5/restapi"
+)
+
+func TestAuthorize(t *testing.T) {
+	t.Parallel()
+
+	spec := restapi.RestSpec{
+		Prefix: "/api",
+		Tables: []restapi.Table{{Endpoints: []restapi.Endpoint{
+			{Method: "GET", URL: "/items/:item", Callback: "HandleGetItem"},
+			{Method: "DELETE", URL: "/items/:item", Callback: "HandleGetItem"},
+			{Method: "POST", URL: "/search/:item", Callback: "HandleGetItem", Scope: restapi.ScopeRead},
+		}}},
+	}
+
+	e := restapi.NewEngine()
+	if err := e.AddToken("reader", restapi.ScopeRead); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddToken("writer", restapi.ScopeWrite); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddToken(" ", restapi.ScopeWrite); err == nil {
+		t.Errorf("expected error for empty token")
+	}
+	if err := e.AddSpec(spec, testHandler{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method string
+		url    string
+		token  string
+		want   int
+	}{
+		{"GET", "/api/items/a", "", http.StatusUnauthorized},
+		{"GET", "/api/items/a", "wrong", http.StatusUnauthorized},
+		{"GET", "/api/items/a", "reader", http.StatusOK},
+		{"GET", "/api/items/a", "writer", http.StatusOK},
+		{"DELETE", "/api/items/a", "reader", http.StatusForbidden},
+		{"DELETE", "/api/items/a", "writer", http.StatusOK},
+		{"POST", "/api/search/a", "reader", http.StatusOK},
+		{"GET", "/api/openapi.json", "", http.StatusUnauthorized},
+		{"GET", "/api/openapi.json", "reader", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.url, nil)
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+		e.Handler().ServeHTTP(w, r)
+		if w.Code != test.want {
+			t.Errorf("%s %s with %q: got %d, want %d", test.method, test.url, test.token, w.Code, test.want)
+		}
+	}
+}
+
+func TestReadTokenFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(path, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if token, err := restapi.ReadTokenFile(path); err != nil || token != "secret" {
+		t.Errorf("got %q, %v", token, err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restapi.ReadTokenFile(path); err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Errorf("expected empty token error, got %v", err)
+	}
+}
@@ -0,0 +1,667 @@
+// Package clientgen generates typed Go clients for REST APIs that are described by a
+// restapi.RestSpec.
+//
+// The generated package is self-contained: it only depends on the standard library. It has a Client
+// type with one service for each of the specification's tables and one method on the service for
+// each of the table's endpoints. For example, a table named "routines" with an endpoint that has an
+// Operation of "Refresh" and a URL of "/routines/:routine" becomes:
+//	func (s *RoutinesService) Refresh(ctx context.Context, routine string) error
+// Methods are named after each Endpoint's Operation, or after its Callback (without the "Handle"
+// prefix) if it doesn't have one. URL parameters become string arguments, in order.
+//
+// Request and Response fields become Go types, following the forms described on restapi.Endpoint:
+// typed values become the matching Go type ("integer" becomes int64 and "number" becomes float64),
+// nested objects become structs, keys beginning with a colon become maps, and arrays become slices.
+// Fields in request types are pointers, so that only the fields that are set are sent. If an
+// endpoint has Request fields, then its method takes a pointer to its request type as the last
+// argument. If it has Response fields, then its method returns its response type. A response that
+// is described by a single plain string (like {"pong": "Simple response"}) is treated as plain text
+// and returned as a string. GET endpoints without any Response fields, like streams, return the
+// response body for the caller to read and close.
+//
+// Error responses are returned as *Error, which holds the status code and the error's message,
+// code, and invalid fields (if any).
+package clientgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/snhilde/statusbar/v5/restapi"
+)
+
+// initialisms are the words that are written in all caps in Go names.
+var initialisms = map[string]bool{
+	"api":  true,
+	"cpu":  true,
+	"http": true,
+	"id":   true,
+	"ip":   true,
+	"json": true,
+	"url":  true,
+	"uri":  true,
+}
+
+// keywords are the Go keywords, which can't be used as argument names.
+var keywords = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true, "default": true,
+	"defer": true, "else": true, "fallthrough": true, "for": true, "func": true, "go": true,
+	"goto": true, "if": true, "import": true, "interface": true, "map": true, "package": true,
+	"range": true, "return": true, "select": true, "struct": true, "switch": true, "type": true,
+	"var": true,
+}
+
+// generator holds the state of a single run of Generate.
+type generator struct {
+	// Generated types, in the order they were defined.
+	types bytes.Buffer
+
+	// Names of the generated types, so that they don't collide.
+	names map[string]bool
+
+	// Top-level request or response type that is being defined.
+	owner string
+
+	// Whether or not the generated code needs these packages.
+	usesURL bool
+	usesIO  bool
+}
+
+// Generate generates the source code of a Go package named pkg with a typed client for the spec.
+// The code is formatted with gofmt.
+func Generate(spec restapi.RestSpec, pkg string) ([]byte, error) {
+	if pkg == "" {
+		return nil, fmt.Errorf("missing package name")
+	}
+
+	g := &generator{names: make(map[string]bool)}
+	for _, name := range []string{"Client", "Error", "FieldError", "New", "NewUnix", "String", "Int", "Float", "Bool"} {
+		g.names[name] = true
+	}
+
+	var services, fields, inits bytes.Buffer
+	for _, table := range spec.Tables {
+		if len(table.Endpoints) == 0 {
+			continue
+		}
+
+		service := goName(table.Name)
+		if service == "" {
+			return nil, fmt.Errorf("invalid table name: %q", table.Name)
+		}
+		serviceType := service + "Service"
+		if g.names[serviceType] || g.names[service] {
+			return nil, fmt.Errorf("duplicate table name: %q", table.Name)
+		}
+		g.names[serviceType] = true
+
+		fmt.Fprintf(&fields, "\n%s\n%s *%s\n", comment(table.Desc), service, serviceType)
+		fmt.Fprintf(&inits, "c.%s = &%s{c}\n", service, serviceType)
+
+		fmt.Fprintf(&services, "\n// %s handles the endpoints in the %q table.\n", serviceType, table.Name)
+		fmt.Fprintf(&services, "type %s struct {\nclient *Client\n}\n", serviceType)
+
+		methods := make(map[string]bool)
+		for _, endpoint := range table.Endpoints {
+			method, err := g.method(service, serviceType, endpoint)
+			if err != nil {
+				return nil, err
+			}
+			name := operationName(endpoint)
+			if methods[name] {
+				return nil, fmt.Errorf("duplicate operation in table %q: %s", table.Name, name)
+			}
+			methods[name] = true
+			services.WriteString(method)
+		}
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by clientgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "// Package %s is a client for the %s (%s), version %.1f.\n", pkg, spec.Name, spec.Prefix, spec.Version)
+	fmt.Fprintf(&src, "package %s\n\n", pkg)
+
+	src.WriteString("import (\n\"bytes\"\n\"context\"\n\"encoding/json\"\n\"fmt\"\n")
+	if g.usesIO {
+		src.WriteString("\"io\"\n")
+	}
+	src.WriteString("\"io/ioutil\"\n\"net\"\n\"net/http\"\n")
+	if g.usesURL {
+		src.WriteString("\"net/url\"\n")
+	}
+	src.WriteString("\"strings\"\n)\n\n")
+
+	fmt.Fprintf(&src, "// prefix is the path prefix of every endpoint.\nconst prefix = %q\n", spec.Prefix)
+	src.WriteString(strings.Replace(runtime, "\t// <services>\n", fields.String(), 1))
+	src.WriteString(strings.Replace(constructor, "\t// <inits>\n", inits.String(), 1))
+	src.Write(services.Bytes())
+	src.Write(g.types.Bytes())
+
+	out, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w", err)
+	}
+
+	return out, nil
+}
+
+// method generates the service's method for the endpoint.
+func (g *generator) method(service string, serviceType string, endpoint restapi.Endpoint) (string, error) {
+	name := operationName(endpoint)
+	if name == "" {
+		return "", fmt.Errorf("missing operation or callback for %s %s", endpoint.Method, endpoint.URL)
+	}
+
+	// Build the arguments and the expression for the path.
+	args := []string{"ctx context.Context"}
+	var path []string
+	static := ""
+	for _, part := range strings.Split(strings.Trim(endpoint.URL, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		if !strings.HasPrefix(part, ":") && !strings.HasPrefix(part, "*") {
+			static += "/" + part
+			continue
+		}
+
+		arg := argName(part[1:])
+		args = append(args, arg+" string")
+		path = append(path, fmt.Sprintf("%q", static+"/"), "url.PathEscape("+arg+")")
+		static = ""
+		g.usesURL = true
+	}
+	if static != "" || len(path) == 0 {
+		path = append(path, fmt.Sprintf("%q", static))
+	}
+	pathExpr := strings.Join(path, " + ")
+
+	body := "nil"
+	if len(endpoint.Request) > 0 {
+		reqType := g.define(service+name+"Request", "request body for "+service+"."+name, endpoint.Request, true)
+		args = append(args, "body *"+reqType)
+		body = "body"
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "\n// %s calls %s %s.", name, endpoint.Method, endpoint.URL)
+	if endpoint.Desc != "" {
+		fmt.Fprintf(&b, "\n//\n%s", comment(endpoint.Desc))
+	}
+
+	signature := fmt.Sprintf("func (s *%s) %s(%s)", serviceType, name, strings.Join(args, ", "))
+	switch {
+	case isText(endpoint.Response):
+		fmt.Fprintf(&b, "\n%s (string, error) {\n", signature)
+		fmt.Fprintf(&b, "var out string\nerr := s.client.do(ctx, %q, %s, %s, &out)\nreturn out, err\n}\n", endpoint.Method, pathExpr, body)
+	case len(endpoint.Response) > 0:
+		respType := g.define(service+name+"Response", "response from "+service+"."+name, endpoint.Response, false)
+		if g.isStruct(endpoint.Response) {
+			fmt.Fprintf(&b, "\n%s (*%s, error) {\n", signature, respType)
+			fmt.Fprintf(&b, "out := new(%s)\nif err := s.client.do(ctx, %q, %s, %s, out); err != nil {\nreturn nil, err\n}\nreturn out, nil\n}\n", respType, endpoint.Method, pathExpr, body)
+		} else {
+			fmt.Fprintf(&b, "\n%s (%s, error) {\n", signature, respType)
+			fmt.Fprintf(&b, "var out %s\nerr := s.client.do(ctx, %q, %s, %s, &out)\nreturn out, err\n}\n", respType, endpoint.Method, pathExpr, body)
+		}
+	case endpoint.Method == "GET":
+		g.usesIO = true
+		fmt.Fprintf(&b, "\n%s (io.ReadCloser, error) {\n", signature)
+		fmt.Fprintf(&b, "resp, err := s.client.send(ctx, %q, %s, %s)\nif err != nil {\nreturn nil, err\n}\nreturn resp.Body, nil\n}\n", endpoint.Method, pathExpr, body)
+	default:
+		fmt.Fprintf(&b, "\n%s error {\n", signature)
+		fmt.Fprintf(&b, "return s.client.do(ctx, %q, %s, %s, nil)\n}\n", endpoint.Method, pathExpr, body)
+	}
+
+	return b.String(), nil
+}
+
+// define defines a named type for the top-level fields of a request or response and returns its
+// name. what describes the type for its doc comment, e.g. "response from Routines.Get".
+func (g *generator) define(name string, what string, fields map[string]interface{}, request bool) string {
+	name = g.unique(name)
+	g.owner = name
+	base := strings.TrimSuffix(strings.TrimSuffix(name, "Request"), "Response")
+	doc := fmt.Sprintf("%s is the %s.", name, what)
+
+	if g.isStruct(fields) {
+		g.structType(name, doc, base, fields, request)
+	} else {
+		fieldType := g.typeFor(base, "", fields, request)
+		fmt.Fprintf(&g.types, "\n// %s\ntype %s %s\n", doc, name, fieldType)
+	}
+
+	return name
+}
+
+// structType defines a struct type with the fields. base is used to name any types that the fields
+// need.
+func (g *generator) structType(name string, doc string, base string, fields map[string]interface{}, request bool) {
+	var b bytes.Buffer
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fieldType := g.typeFor(base, key, fields[key], request)
+		if request && !strings.HasPrefix(fieldType, "[]") && !strings.HasPrefix(fieldType, "map[") {
+			fieldType = "*" + fieldType
+		}
+		tag := key
+		if request {
+			tag += ",omitempty"
+		}
+		if desc := description(fields[key]); desc != "" {
+			fmt.Fprintf(&b, "\n%s\n", comment(desc))
+		}
+		fmt.Fprintf(&b, "%s %s `json:%q`\n", goName(key), fieldType, tag)
+	}
+
+	fmt.Fprintf(&g.types, "\n// %s\ntype %s struct {%s}\n", doc, name, b.String())
+}
+
+// typeFor returns the Go type for the field named key, defining any types it needs. base is used to
+// name those types.
+func (g *generator) typeFor(base string, key string, field interface{}, request bool) string {
+	switch f := field.(type) {
+	case string:
+		return "string"
+	case []interface{}:
+		if len(f) == 0 {
+			return "[]interface{}"
+		}
+		return "[]" + g.typeFor(base, singular(key), f[0], request)
+	case map[string]interface{}:
+		if t, ok := leafType(f); ok {
+			return t
+		}
+		if wildcard, ok := wildcardKey(f); ok {
+			return "map[string]" + g.typeFor(base, wildcard[1:], f[wildcard], request)
+		}
+		name := g.unique(base + goName(key))
+		g.structType(name, fmt.Sprintf("%s is part of %s.", name, g.owner), base, f, request)
+		return name
+	}
+
+	return "interface{}"
+}
+
+// isStruct checks whether or not the fields become a struct, as opposed to a map.
+func (g *generator) isStruct(fields map[string]interface{}) bool {
+	_, ok := wildcardKey(fields)
+	return !ok
+}
+
+// unique returns name, or name with a number added if name is already taken.
+func (g *generator) unique(name string) string {
+	unique := name
+	for i := 2; g.names[unique]; i++ {
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+	g.names[unique] = true
+
+	return unique
+}
+
+// operationName returns the name of the endpoint's method.
+func operationName(endpoint restapi.Endpoint) string {
+	if endpoint.Operation != "" {
+		return endpoint.Operation
+	}
+	return strings.TrimPrefix(endpoint.Callback, "Handle")
+}
+
+// leafType returns the Go type for a field that describes a single value.
+func leafType(field map[string]interface{}) (string, bool) {
+	t, ok := field["type"].(string)
+	if !ok {
+		return "", false
+	}
+	for key := range field {
+		if key != "type" && key != "description" {
+			return "", false
+		}
+	}
+
+	switch t {
+	case "string":
+		return "string", true
+	case "number":
+		return "float64", true
+	case "integer":
+		return "int64", true
+	case "boolean":
+		return "bool", true
+	case "object":
+		return "map[string]interface{}", true
+	case "array":
+		return "[]interface{}", true
+	}
+
+	return "interface{}", true
+}
+
+// wildcardKey returns the key of an object that stands for any key, if the object has one.
+func wildcardKey(field map[string]interface{}) (string, bool) {
+	if len(field) != 1 {
+		return "", false
+	}
+	for key := range field {
+		if strings.HasPrefix(key, ":") {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
+// isText checks whether or not a response is described by a single plain string, meaning that it
+// is plain text.
+func isText(fields map[string]interface{}) bool {
+	if len(fields) != 1 {
+		return false
+	}
+	for _, field := range fields {
+		_, ok := field.(string)
+		return ok
+	}
+
+	return false
+}
+
+// description returns the description of a field, if it has one.
+func description(field interface{}) string {
+	switch f := field.(type) {
+	case string:
+		return f
+	case map[string]interface{}:
+		if _, ok := leafType(f); ok {
+			desc, _ := f["description"].(string)
+			return desc
+		}
+	}
+
+	return ""
+}
+
+// goName converts a name like "last_success" or "bar-stream" into an exported Go name like
+// "LastSuccess".
+func goName(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var b strings.Builder
+	for _, word := range words {
+		if initialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+
+	name = b.String()
+	if name != "" && unicode.IsDigit([]rune(name)[0]) {
+		name = "X" + name
+	}
+
+	return name
+}
+
+// argName converts a URL parameter into an argument name, e.g. "routine_id" into "routineID".
+func argName(param string) string {
+	name := goName(param)
+	if name == "" {
+		return "param"
+	}
+
+	// Lowercase the first word, which might be an initialism.
+	runes := []rune(name)
+	for i := 0; i < len(runes) && unicode.IsUpper(runes[i]); i++ {
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	name = string(runes)
+
+	if keywords[name] || name == "ctx" || name == "body" || name == "s" {
+		name += "Param"
+	}
+
+	return name
+}
+
+// singular makes a plural name singular, e.g. "routines" into "routine".
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "ss"), strings.HasSuffix(name, "us"):
+		return name
+	case strings.HasSuffix(name, "s"):
+		return strings.TrimSuffix(name, "s")
+	}
+
+	return name
+}
+
+// commentWidth is the width that generated comments are wrapped at, not counting indentation.
+const commentWidth = 100
+
+// comment formats text as a Go comment, wrapping long lines.
+func comment(text string) string {
+	var lines []string
+	for _, paragraph := range strings.Split(strings.TrimSpace(text), "\n") {
+		line := "//"
+		for _, word := range strings.Fields(paragraph) {
+			if len(line) > 2 && len(line)+1+len(word) > commentWidth {
+				lines = append(lines, line)
+				line = "//"
+			}
+			line += " " + word
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) == 1 && lines[0] == "//" {
+		return ""
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// runtime is the code that every generated client uses to make requests.
+const runtime = `
+// Client is a client for the API. Each group of endpoints is handled by one of its services.
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+	// <services>
+}
+
+// Error is an error response from the API.
+type Error struct {
+	// HTTP status code of the response.
+	StatusCode int ` + "`json:\"-\"`" + `
+
+	// Human-readable error message.
+	Message string ` + "`json:\"error\"`" + `
+
+	// Machine-readable error code, if the API sent one.
+	Code string ` + "`json:\"code,omitempty\"`" + `
+
+	// Invalid fields in the request, if any.
+	Fields []FieldError ` + "`json:\"fields,omitempty\"`" + `
+}
+
+// FieldError describes a single invalid field in a request.
+type FieldError struct {
+	// Path to the field, e.g. "colors.foreground".
+	Field string ` + "`json:\"field\"`" + `
+
+	// What is wrong with the field.
+	Message string ` + "`json:\"message\"`" + `
+}
+
+// Error formats the error response.
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
+	for _, f := range e.Fields {
+		msg += fmt.Sprintf("; %s: %s", f.Field, f.Message)
+	}
+
+	return fmt.Sprintf("%d: %s", e.StatusCode, msg)
+}
+`
+
+// constructor is the code that builds generated clients and sends their requests.
+const constructor = `
+// New creates a new client for the API at baseURL, e.g. "http://localhost:1234".
+func New(baseURL string) *Client {
+	return newClient(strings.TrimRight(baseURL, "/"), http.DefaultClient)
+}
+
+// NewUnix creates a new client for the API on the Unix socket at path.
+func NewUnix(path string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}
+
+	return newClient("http://unix", &http.Client{Transport: transport})
+}
+
+// newClient creates a new client and its services.
+func newClient(baseURL string, httpClient *http.Client) *Client {
+	c := &Client{httpClient: httpClient, baseURL: baseURL}
+	// <inits>
+
+	return c
+}
+
+// SetToken sets the bearer token to send with every request.
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// SetHTTPClient sets the HTTP client that is used to send requests, e.g. to set a timeout.
+func (c *Client) SetHTTPClient(httpClient *http.Client) {
+	if httpClient != nil {
+		c.httpClient = httpClient
+	}
+}
+
+// send sends a request with body (if not nil) encoded as JSON. Error responses are returned as
+// *Error.
+func (c *Client) send(ctx context.Context, method string, path string, body interface{}) (*http.Response, error) {
+	var r *bytes.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	var request *http.Request
+	var err error
+	if r != nil {
+		request, err = http.NewRequestWithContext(ctx, method, c.baseURL+prefix+path, r)
+	} else {
+		request, err = http.NewRequestWithContext(ctx, method, c.baseURL+prefix+path, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if b, err := ioutil.ReadAll(resp.Body); err == nil {
+			if json.Unmarshal(b, apiErr) != nil {
+				apiErr.Message = strings.TrimSpace(string(b))
+			}
+		}
+		return nil, apiErr
+	}
+
+	return resp, nil
+}
+
+// do sends a request and decodes the response into out. If out is a *string, then the response is
+// stored as-is. If out is nil, then the response is discarded.
+func (c *Client) do(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch v := out.(type) {
+	case nil:
+		return nil
+	case *string:
+		*v = string(b)
+		return nil
+	}
+
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(b, out)
+}
+
+// String returns a pointer to s, for setting optional request fields.
+func String(s string) *string {
+	return &s
+}
+
+// Int returns a pointer to i, for setting optional request fields.
+func Int(i int64) *int64 {
+	return &i
+}
+
+// Float returns a pointer to f, for setting optional request fields.
+func Float(f float64) *float64 {
+	return &f
+}
+
+// Bool returns a pointer to b, for setting optional request fields.
+func Bool(b bool) *bool {
+	return &b
+}
+`
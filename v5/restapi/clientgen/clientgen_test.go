@@ -0,0 +1,120 @@
+package clientgen_test
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/snhilde/statusbar/v5/restapi"
+	"github.com/snhilde/statusbar/v5/restapi/clientgen"
+)
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	spec := restapi.RestSpec{
+		Name:    "Test API",
+		Prefix:  "/api/v1",
+		Version: 1,
+		Tables: []restapi.Table{
+			{
+				Name: "items",
+				Endpoints: []restapi.Endpoint{
+					{
+						Method: "GET",
+						URL:    "/items/:item_id/parts/:part",
+						Response: map[string]interface{}{
+							"size":  map[string]interface{}{"type": "integer", "description": "Item's size"},
+							"tags":  []interface{}{"Tag name"},
+							"owner": map[string]interface{}{"name": "Owner's name"},
+							"parts": map[string]interface{}{":part": map[string]interface{}{"type": "number"}},
+						},
+						Callback: "HandleGetPart",
+					},
+					{
+						Method: "PATCH",
+						URL:    "/items/:type",
+						Request: map[string]interface{}{
+							"size": map[string]interface{}{"type": "integer"},
+						},
+						Callback:  "HandlePatchItem",
+						Operation: "Update",
+					},
+					{
+						Method:   "GET",
+						URL:      "/items/stream",
+						Callback: "HandleGetStream",
+					},
+					{
+						Method:   "GET",
+						URL:      "/ping",
+						Response: map[string]interface{}{"pong": "Plain text"},
+						Callback: "HandleGetPing",
+					},
+				},
+			},
+		},
+	}
+
+	src, err := clientgen.Generate(spec, "testclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "client.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Gather the signatures of the methods and the definitions of the types.
+	decls := make(map[string]string)
+	show := func(node interface{}) string {
+		var b bytes.Buffer
+		printer.Fprint(&b, fset, node)
+		return strings.Join(strings.Fields(b.String()), " ")
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			decls[d.Name.Name] = show(d.Type)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok {
+					decls[ts.Name.Name] = show(ts.Type)
+				}
+			}
+		}
+	}
+
+	partResponse := "struct { Owner ItemsGetPartOwner `json:\"owner\"` Parts map[string]float64 `json:\"parts\"` " +
+		"Size int64 `json:\"size\"` Tags []string `json:\"tags\"` }"
+	want := map[string]string{
+		"GetPart":              "func(ctx context.Context, itemID string, part string) (*ItemsGetPartResponse, error)",
+		"Update":               "func(ctx context.Context, typeParam string, body *ItemsUpdateRequest) error",
+		"GetStream":            "func(ctx context.Context) (io.ReadCloser, error)",
+		"GetPing":              "func(ctx context.Context) (string, error)",
+		"ItemsUpdateRequest":   "struct { Size *int64 `json:\"size,omitempty\"` }",
+		"ItemsGetPartOwner":    "struct { Name string `json:\"name\"` }",
+		"ItemsGetPartResponse": partResponse,
+	}
+	for name, decl := range want {
+		if decls[name] != decl {
+			t.Errorf("%s: got %q, want %q", name, decls[name], decl)
+		}
+	}
+
+	if !strings.Contains(string(src), `"/items/"+url.PathEscape(itemID)+"/parts/"+url.PathEscape(part)`) {
+		t.Errorf("missing path for GetPart")
+	}
+
+	// Operations must be unique within a table.
+	spec.Tables[0].Endpoints[3].Operation = "Update"
+	if _, err := clientgen.Generate(spec, "testclient"); err == nil {
+		t.Errorf("expected error for duplicate operation")
+	}
+}
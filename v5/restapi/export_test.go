@@ -0,0 +1,26 @@
+package restapi
+
+import (
+	"net/http"
+	"time"
+)
+
+// These expose some of the package's internals to the tests in restapi_test.
+
+// Handler returns the engine's handler with its middleware applied, for sending test requests.
+func (e *Engine) Handler() http.Handler {
+	return e.handler()
+}
+
+// RateLimiter is the rate limiter used by RateLimit.
+type RateLimiter = rateLimiter
+
+// NewRateLimiter makes a rate limiter like RateLimit does.
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	return &rateLimiter{rate: perSecond, burst: float64(burst), buckets: make(map[string]*bucket)}
+}
+
+// Allow checks whether or not the client can make a request at the time.
+func (l *rateLimiter) Allow(client string, now time.Time) (time.Duration, bool) {
+	return l.allow(client, now)
+}
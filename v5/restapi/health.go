@@ -0,0 +1,169 @@
+// This file contains the logic for running the engine's TCP listener, reporting its health, and
+// moving it to a new address while the engine is running.
+
+package restapi
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// drainTimeout is how long the old server is given to finish its requests after the engine moves to
+// a new address.
+const drainTimeout = 5 * time.Second
+
+// Health describes the state of the engine's listeners.
+type Health struct {
+	// Whether or not the engine is serving requests over TCP.
+	Ready bool
+
+	// Address that the engine is listening on over TCP, e.g. "127.0.0.1:1234". This is empty if the
+	// engine is not listening on TCP.
+	Address string
+
+	// Paths of the Unix sockets that the engine is listening on.
+	Sockets []string
+
+	// Error that stopped the TCP listener, if it stopped on its own.
+	Err error
+}
+
+// Health returns the state of the engine's listeners.
+func (e *Engine) Health() Health {
+	if e == nil {
+		return Health{}
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	h := Health{
+		Ready:   e.server != nil,
+		Address: e.addr,
+		Sockets: make([]string, 0, len(e.unixServers)),
+		Err:     e.serveErr,
+	}
+	for path := range e.unixServers {
+		h.Sockets = append(h.Sockets, path)
+	}
+	sort.Strings(h.Sockets)
+
+	return h
+}
+
+// Rebind moves the engine's TCP listener to a new host and port while the engine is running. The
+// engine usually starts listening on the new address before it stops listening on the old one. If
+// the new address overlaps the old one, like the same port on all interfaces, then the old listener
+// is closed first to free up the address. Either way, requests that are already being handled on
+// the old address are given time to finish. If the engine can't listen on the new address, then it
+// goes back to the old one and the error is returned, along with any error from going back. If the
+// engine is not listening on TCP, then this starts it like Run. Unix sockets are not affected.
+func (e *Engine) Rebind(host string, port int) error {
+	if e == nil || e.engine == nil {
+		return fmt.Errorf("invalid Engine")
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	oldServer, oldListener, oldAddr := e.server, e.listener, e.addr
+
+	err := e.listen(addr)
+	if err != nil && oldListener != nil {
+		// The new address might overlap the old one. Free up the old address and try again, going
+		// back to the old address if that doesn't work either.
+		oldListener.Close()
+		if err = e.listen(addr); err != nil {
+			if rerr := e.listen(oldAddr); rerr != nil {
+				e.server = nil
+				e.listener = nil
+				e.addr = ""
+				e.serveErr = rerr
+				err = fmt.Errorf("%w (and failed to listen on %v again: %v)", err, oldAddr, rerr)
+			}
+		}
+	}
+
+	// Shut down the old server if it was replaced, even if we ended up back on the old address.
+	if oldServer != nil && e.server != oldServer {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+			defer cancel()
+			oldServer.Shutdown(ctx)
+		}()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	e.host = host
+
+	return nil
+}
+
+// listen listens on the address and serves the engine on it in a new goroutine. The engine's mutex
+// must be held.
+func (e *Engine) listen(addr string) error {
+	// We need to create a new server every time because a server cannot be reused after it is shut
+	// down.
+	server := new(http.Server)
+	server.Handler = e.handler()
+
+	// Load the certificate now so that problems with it are reported right away.
+	if e.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(e.certFile, e.keyFile)
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	e.server = server
+	e.listener = listener
+	e.addr = listener.Addr().String()
+	e.serveErr = nil
+
+	go e.serve(server, listener)
+
+	return nil
+}
+
+// serve serves the engine on the listener until the server is shut down. If it stops for any other
+// reason, then the error is saved for Health.
+func (e *Engine) serve(server *http.Server, listener net.Listener) {
+	var err error
+	if server.TLSConfig != nil {
+		err = server.ServeTLS(listener, "", "")
+	} else {
+		err = server.Serve(listener)
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// Don't report anything if the engine has already moved on from this server.
+	if e.server == server {
+		e.server = nil
+		e.listener = nil
+		e.addr = ""
+		e.serveErr = err
+	}
+}
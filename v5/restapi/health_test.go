@@ -0,0 +1,114 @@
+package restapi_test
+
+import (
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/snhilde/statusbar/v5/restapi"
+)
+
+func TestRebind(t *testing.T) {
+	t.Parallel()
+
+	spec := restapi.RestSpec{
+		Prefix: "/api",
+		Tables: []restapi.Table{{Endpoints: []restapi.Endpoint{
+			{Method: "GET", URL: "/items/:item", Callback: "HandleGetItem"},
+		}}},
+	}
+
+	e := restapi.NewEngine()
+	if err := e.AddSpec(spec, testHandler{}); err != nil {
+		t.Fatal(err)
+	}
+	defer e.Stop(1)
+
+	if h := e.Health(); h.Ready {
+		t.Errorf("engine is ready before running")
+	}
+
+	if err := e.Run(0); err != nil {
+		t.Fatal(err)
+	}
+	first := e.Health()
+	if !first.Ready || first.Address == "" {
+		t.Fatalf("got %+v after running", first)
+	}
+	get(t, first.Address, http.StatusOK)
+
+	// The engine can't run twice.
+	if err := e.Run(0); err == nil {
+		t.Errorf("expected error for running twice")
+	}
+
+	// Ports that are in use are reported right away.
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	busyPort := busy.Addr().(*net.TCPAddr).Port
+	if err := restapi.NewEngine().Run(busyPort); err == nil {
+		t.Errorf("expected error for port in use")
+	}
+
+	// Failing to rebind leaves the old address in place.
+	if err := e.Rebind("127.0.0.1", busyPort); err == nil {
+		t.Errorf("expected error for rebinding to port in use")
+	}
+	if h := e.Health(); !h.Ready || h.Address != first.Address {
+		t.Errorf("got %+v after failed rebind, want %+v", h, first)
+	}
+	get(t, first.Address, http.StatusOK)
+
+	// Rebinding to the same address works, even though it is already in use by the engine.
+	_, port, _ := net.SplitHostPort(first.Address)
+	p, _ := strconv.Atoi(port)
+	if err := e.Rebind("127.0.0.1", p); err != nil {
+		t.Errorf("rebinding to the same address: %v", err)
+	}
+	get(t, first.Address, http.StatusOK)
+
+	// Rebinding to a new address moves the engine there.
+	if err := e.Rebind("127.0.0.1", 0); err != nil {
+		t.Fatal(err)
+	}
+	second := e.Health()
+	if !second.Ready || second.Address == first.Address {
+		t.Errorf("got %+v after rebinding", second)
+	}
+	get(t, second.Address, http.StatusOK)
+
+	// Bad certificates are reported right away too.
+	tlsEngine := restapi.NewEngine()
+	dir := t.TempDir()
+	if err := tlsEngine.SetTLS(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tlsEngine.Run(0); err == nil {
+		t.Errorf("expected error for missing certificate")
+	}
+	if h := tlsEngine.Health(); h.Ready {
+		t.Errorf("engine is ready after failing to run")
+	}
+}
+
+// get makes a request to the engine at addr and checks the response code.
+func get(t *testing.T, addr string, code int) {
+	t.Helper()
+
+	client := http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Get("http://" + addr + "/api/items/a")
+	if err != nil {
+		t.Errorf("GET from %s: %v", addr, err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != code {
+		t.Errorf("GET from %s: got %d, want %d", addr, resp.StatusCode, code)
+	}
+}
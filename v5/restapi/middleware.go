@@ -0,0 +1,300 @@
+// This file contains the middleware that the engine provides for use with Use.
+
+package restapi
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Middleware wraps an http.Handler with another one that can act on each request before and after
+// the wrapped handler serves it, or answer the request itself.
+type Middleware func(http.Handler) http.Handler
+
+// requestIDHeader is the header that carries the request's ID.
+const requestIDHeader = "X-Request-ID"
+
+// requestIDKey is the context key for the request's ID.
+type requestIDKey struct{}
+
+// CORS returns middleware that allows browsers on the listed origins (e.g.
+// "https://example.com") to make cross-origin requests to the API. An origin of "*" allows every
+// origin. Preflight requests from allowed origins are answered directly, and requests from other
+// origins are passed through without any CORS headers, which means that browsers block them.
+func CORS(origins ...string) Middleware {
+	allowed := make(map[string]bool)
+	for _, origin := range origins {
+		allowed[strings.TrimRight(origin, "/")] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" || (!allowed["*"] && !allowed[origin]) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Add("Vary", "Origin")
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Set("Access-Control-Expose-Headers", requestIDHeader)
+
+			// Answer preflight requests here, so that they don't need a token.
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				header.Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+				header.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, "+requestIDHeader)
+				header.Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequestIDs returns middleware that gives every request an ID, which is sent back to the client in
+// the "X-Request-ID" header. If the client sends its own ID in that header, then that ID is used
+// instead. Handlers can get the ID with RequestID.
+func RequestIDs() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(requestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+
+			w.Header().Set(requestIDHeader, id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		})
+	}
+}
+
+// RequestID returns the ID that RequestIDs gave the request, or an empty string if it doesn't have
+// one.
+func RequestID(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID checks that an ID from a client is safe to use and log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newRequestID generates a random request ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// accessEntry is a single line of the access log.
+type accessEntry struct {
+	Time      string  `json:"time"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Status    int     `json:"status"`
+	Bytes     int     `json:"bytes"`
+	Duration  float64 `json:"duration_ms"`
+	Remote    string  `json:"remote"`
+	RequestID string  `json:"request_id,omitempty"`
+}
+
+// AccessLog returns middleware that writes a line of JSON to w for every request once it has been
+// served, like this:
+//	{"time":"2021-01-07T15:04:05Z","method":"GET","path":"/rest/v1/ping","status":200,"bytes":4,"duration_ms":0.12,"remote":"127.0.0.1:51234","request_id":"..."}
+// The request ID is included if RequestIDs is also used.
+func AccessLog(w io.Writer) Middleware {
+	var mutex sync.Mutex
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: rw}
+			next.ServeHTTP(recorder, r)
+
+			if recorder.status == 0 {
+				recorder.status = http.StatusOK
+			}
+			entry := accessEntry{
+				Time:      start.UTC().Format(time.RFC3339),
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Status:    recorder.status,
+				Bytes:     recorder.bytes,
+				Duration:  float64(time.Since(start).Microseconds()) / 1000,
+				Remote:    r.RemoteAddr,
+				RequestID: rw.Header().Get(requestIDHeader),
+			}
+
+			b, err := json.Marshal(entry)
+			if err != nil {
+				return
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			w.Write(append(b, '\n'))
+		})
+	}
+}
+
+// statusRecorder keeps track of the status code and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets handlers take over the connection through the recorder.
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijacking not supported")
+	}
+	return h.Hijack()
+}
+
+// RateLimit returns middleware that limits each client to perSecond requests per second on average,
+// with bursts of up to burst requests. Clients are told apart by IP address, and requests over Unix
+// sockets share one limit. Requests over the limit receive a 429 response with a "Retry-After"
+// header.
+func RateLimit(perSecond float64, burst int) Middleware {
+	limiter := &rateLimiter{
+		rate:    perSecond,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+
+			if wait, ok := limiter.allow(host, time.Now()); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				io.WriteString(w, encodeError(errorResponse{Error: "too many requests", Code: "rate_limited"}))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimiter keeps a token bucket for each client.
+type rateLimiter struct {
+	mutex sync.Mutex
+
+	// Tokens added to each bucket per second.
+	rate float64
+
+	// Most tokens that a bucket can hold.
+	burst float64
+
+	// Buckets, keyed by client.
+	buckets map[string]*bucket
+
+	// Last time that idle buckets were cleaned out.
+	pruned time.Time
+}
+
+// bucket is a single client's token bucket.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow takes a token from the client's bucket. If the bucket is empty, then this returns how long
+// until the next token is added and false.
+func (l *rateLimiter) allow(client string, now time.Time) (time.Duration, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// Every so often, forget clients whose buckets have filled back up.
+	if now.Sub(l.pruned) > time.Minute {
+		for key, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+				delete(l.buckets, key)
+			}
+		}
+		l.pruned = now
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		if l.rate <= 0 {
+			return time.Minute, false
+		}
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), false
+	}
+
+	b.tokens--
+	return 0, true
+}
@@ -0,0 +1,123 @@
+package restapi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/snhilde/statusbar/v5/restapi"
+)
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	spec := restapi.RestSpec{
+		Prefix: "/api",
+		Tables: []restapi.Table{{Endpoints: []restapi.Endpoint{
+			{Method: "GET", URL: "/items/:item", Callback: "HandleGetItem"},
+		}}},
+	}
+
+	var log bytes.Buffer
+	e := restapi.NewEngine()
+	e.Use(restapi.AccessLog(&log), restapi.CORS("https://example.com"), restapi.RequestIDs(), restapi.RateLimit(1, 2))
+	if err := e.AddToken("secret", restapi.ScopeRead); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddSpec(spec, testHandler{}); err != nil {
+		t.Fatal(err)
+	}
+	h := e.Handler()
+
+	// Preflight requests are answered without a token and don't count against the rate limit.
+	r := httptest.NewRequest("OPTIONS", "/api/items/a", nil)
+	r.Header.Set("Origin", "https://example.com")
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://example.com" {
+		t.Errorf("preflight: got %d with headers %v", w.Code, w.Header())
+	}
+
+	// Other origins don't get any CORS headers.
+	r = httptest.NewRequest("GET", "/api/items/a", nil)
+	r.Header.Set("Origin", "https://example.org")
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set("X-Request-ID", "abc123")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("other origin: got %d with headers %v", w.Code, w.Header())
+	}
+	if id := w.Header().Get("X-Request-ID"); id != "abc123" {
+		t.Errorf("got request ID %q, want %q", id, "abc123")
+	}
+
+	// A new ID is made if the client doesn't send one.
+	r = httptest.NewRequest("GET", "/api/items/a", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized || len(w.Header().Get("X-Request-ID")) != 32 {
+		t.Errorf("missing token: got %d with headers %v", w.Code, w.Header())
+	}
+
+	// That was the second request, so the third is over the limit.
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/items/a", nil))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("rate limit: got %d with headers %v", w.Code, w.Header())
+	}
+
+	// Every request is logged.
+	type accessEntry struct {
+		Path      string `json:"path"`
+		Status    int    `json:"status"`
+		Bytes     int    `json:"bytes"`
+		RequestID string `json:"request_id"`
+	}
+	var entries []accessEntry
+	decoder := json.NewDecoder(&log)
+	for decoder.More() {
+		var entry accessEntry
+		if err := decoder.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	wantStatus := []int{204, 200, 401, 429}
+	if len(entries) != len(wantStatus) {
+		t.Fatalf("got %d log entries, want %d", len(entries), len(wantStatus))
+	}
+	for i, entry := range entries {
+		// The preflight request is answered before it reaches RequestIDs.
+		if entry.Status != wantStatus[i] || entry.Path != "/api/items/a" || (i > 0 && entry.RequestID == "") {
+			t.Errorf("entry %d: got %+v", i, entry)
+		}
+	}
+	if entries[1].RequestID != "abc123" || entries[1].Bytes != len(`{"item":"a"}`) {
+		t.Errorf("entry 1: got %+v", entries[1])
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	l := restapi.NewRateLimiter(2, 1)
+	now := time.Now()
+
+	if _, ok := l.Allow("a", now); !ok {
+		t.Errorf("first request was not allowed")
+	}
+	if wait, ok := l.Allow("a", now); ok || wait != 500*time.Millisecond {
+		t.Errorf("second request: got %v, %v", wait, ok)
+	}
+	if _, ok := l.Allow("b", now); !ok {
+		t.Errorf("other client was not allowed")
+	}
+	if _, ok := l.Allow("a", now.Add(500*time.Millisecond)); !ok {
+		t.Errorf("request after waiting was not allowed")
+	}
+}
@@ -0,0 +1,131 @@
+// This file contains the logic for mounting specifications that belong to a single value of a path
+// parameter, like the endpoints that an individual item adds for itself.
+
+package restapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mount is a single route that is shared by every specification added with AddSpecFor for the same
+// method and path. Requests are passed to the handler registered for the path parameter's value.
+type mount struct {
+	// Name of the path parameter that selects the handler.
+	param string
+
+	// Handlers for this route, keyed by the path parameter's value.
+	handlers map[string]gin.HandlerFunc
+}
+
+// AddSpecFor adds the endpoints in the specification to Engine's routes for only one value of a
+// path parameter in the specification's prefix. This lets several handlers share the same routes.
+// For example, if two specifications with a prefix of "/users/:user" and an endpoint of "/avatar"
+// are added with the values "alice" and "bob" for the parameter "user", then "/users/alice/avatar"
+// is handled by the first handler and "/users/bob/avatar" by the second. Requests for any other
+// value receive a 404 response.
+//
+// If done is not nil, then it is called with the endpoint and the response code after each
+// HandlerFunc callback returns. Unlike AddSpec, this does not serve an OpenAPI document or
+// documentation page for the specification, and the specification is not included in Specs. This
+// must be called before the engine is run.
+func (e *Engine) AddSpecFor(spec RestSpec, handler interface{}, param, value string, done func(Endpoint, int)) error {
+	if e == nil || e.engine == nil {
+		return fmt.Errorf("invalid Engine")
+	}
+
+	if !strings.Contains(spec.Prefix+"/", "/:"+param+"/") {
+		return fmt.Errorf("prefix %s does not have parameter %s", spec.Prefix, param)
+	}
+
+	if e.mounts == nil {
+		e.mounts = make(map[string]*mount)
+	}
+
+	handlerType := reflect.ValueOf(handler)
+
+	// Build all of the handlers before adding any, so that a bad specification doesn't leave only
+	// some of its endpoints in place.
+	type route struct {
+		key      string
+		method   string
+		path     string
+		callback gin.HandlerFunc
+	}
+	routes := make([]route, 0)
+	for _, table := range spec.Tables {
+		for _, endpoint := range table.Endpoints {
+			if endpoint.Scope != "" && endpoint.Scope != ScopeRead && endpoint.Scope != ScopeWrite {
+				return fmt.Errorf("invalid scope for %s: %s", endpoint.URL, endpoint.Scope)
+			}
+
+			method, err := findMethod(handlerType, endpoint)
+			if err != nil {
+				return err
+			}
+
+			path := spec.Prefix + endpoint.URL
+			key := endpoint.Method + " " + path
+			if m, ok := e.mounts[key]; ok {
+				if m.param != param {
+					return fmt.Errorf("%s is already mounted for parameter %s", key, m.param)
+				}
+				if _, ok := m.handlers[value]; ok {
+					return fmt.Errorf("%s is already mounted for %s", key, value)
+				}
+			}
+
+			routes = append(routes, route{key, endpoint.Method, path, e.endpointHandler(method, endpoint, done)})
+		}
+	}
+
+	for _, r := range routes {
+		m, ok := e.mounts[r.key]
+		if !ok {
+			m = &mount{param: param, handlers: make(map[string]gin.HandlerFunc)}
+			if err := e.handle(r.method, r.path, e.mountHandler(m)); err != nil {
+				return err
+			}
+			e.mounts[r.key] = m
+		}
+		m.handlers[value] = r.callback
+	}
+
+	return nil
+}
+
+// handle registers the route with Gin, which panics if the route conflicts with one that is already
+// registered. The panic is returned as an error instead.
+func (e *Engine) handle(method string, path string, h gin.HandlerFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("cannot add %s %s: %v", method, path, r)
+		}
+	}()
+
+	e.engine.Handle(method, path, h)
+
+	return nil
+}
+
+// mountHandler builds the Gin handler that passes requests on to the mount's handler for the path
+// parameter's value.
+func (e *Engine) mountHandler(m *mount) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h, ok := m.handlers[c.Param(m.param)]
+		if !ok {
+			// Don't tell clients without access what does or doesn't exist.
+			if e.authorize(c, ScopeRead) {
+				c.Header("Content-Type", "application/json")
+				c.String(http.StatusNotFound, encodeError(errorResponse{Error: "not found", Code: "not_found"}))
+			}
+			return
+		}
+
+		h(c)
+	}
+}
@@ -0,0 +1,80 @@
+package restapi_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/snhilde/statusbar/v5/restapi"
+)
+
+type namedHandler string
+
+func (h namedHandler) HandleGetName(_ restapi.Endpoint, params restapi.Params, _ *http.Request) (int, string) {
+	return 200, string(h)
+}
+
+func TestAddSpecFor(t *testing.T) {
+	t.Parallel()
+
+	spec := restapi.RestSpec{
+		Prefix: "/api/users/:user",
+		Tables: []restapi.Table{{Endpoints: []restapi.Endpoint{
+			{Method: "GET", URL: "/name", Callback: "HandleGetName"},
+		}}},
+	}
+
+	e := restapi.NewEngine()
+	if err := e.AddSpec(restapi.RestSpec{Prefix: "/api", Tables: []restapi.Table{{Endpoints: []restapi.Endpoint{
+		{Method: "GET", URL: "/users/:user", Callback: "HandleGetName"},
+	}}}}, namedHandler("Anyone")); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+	done := func(endpoint restapi.Endpoint, code int) { calls++ }
+	if err := e.AddSpecFor(spec, namedHandler("Alice"), "user", "alice", done); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddSpecFor(spec, namedHandler("Bob"), "user", "bob", done); err != nil {
+		t.Fatal(err)
+	}
+
+	// These should all be rejected.
+	if err := e.AddSpecFor(spec, namedHandler("Alice"), "user", "alice", nil); err == nil {
+		t.Errorf("expected error for duplicate value")
+	}
+	if err := e.AddSpecFor(spec, namedHandler("Carol"), "item", "carol", nil); err == nil {
+		t.Errorf("expected error for missing parameter")
+	}
+	if err := e.AddSpecFor(spec, testHandler{}, "user", "carol", nil); err == nil {
+		t.Errorf("expected error for missing callback")
+	}
+	conflict := restapi.RestSpec{Prefix: "/api/users/:name", Tables: spec.Tables}
+	if err := e.AddSpecFor(conflict, namedHandler("Carol"), "name", "carol", nil); err == nil {
+		t.Errorf("expected error for conflicting route")
+	}
+
+	tests := []struct {
+		url  string
+		code int
+		body string
+	}{
+		{"/api/users/alice/name", http.StatusOK, "Alice"},
+		{"/api/users/bob/name", http.StatusOK, "Bob"},
+		{"/api/users/carol/name", http.StatusNotFound, `{"error":"not found","code":"not_found"}`},
+		{"/api/users/alice", http.StatusOK, "Anyone"},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		e.Handler().ServeHTTP(w, httptest.NewRequest("GET", test.url, nil))
+		if w.Code != test.code || w.Body.String() != test.body {
+			t.Errorf("%s: got %d %q, want %d %q", test.url, w.Code, w.Body.String(), test.code, test.body)
+		}
+	}
+
+	if calls != 2 {
+		t.Errorf("done called %d times, want 2", calls)
+	}
+}
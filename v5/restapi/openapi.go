@@ -0,0 +1,239 @@
+// This file contains the logic for converting a RestSpec into an OpenAPI 3 document and rendering a
+// documentation page for it.
+
+package restapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// openAPIVersion is the version of the OpenAPI Specification that the generated documents follow.
+const openAPIVersion = "3.0.3"
+
+// OpenAPI converts the specification into an OpenAPI 3 document. The endpoint tables become tags,
+// URL parameters like ":routine" become path parameters, and the Request and Response fields of
+// each endpoint become JSON schemas. See Endpoint for how the fields are interpreted.
+func (s RestSpec) OpenAPI() map[string]interface{} {
+	paths := make(map[string]interface{})
+	tags := make([]interface{}, 0, len(s.Tables))
+
+	for _, table := range s.Tables {
+		tags = append(tags, map[string]interface{}{
+			"name":        table.Name,
+			"description": table.Desc,
+		})
+
+		for _, endpoint := range table.Endpoints {
+			path := openAPIPath(s.Prefix + endpoint.URL)
+			item, ok := paths[path].(map[string]interface{})
+			if !ok {
+				item = make(map[string]interface{})
+				paths[path] = item
+			}
+			item[strings.ToLower(endpoint.Method)] = openAPIOperation(table, endpoint)
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":       s.Name,
+			"description": s.Desc,
+			"version":     fmt.Sprintf("%.1f", s.Version),
+		},
+		"tags":  tags,
+		"paths": paths,
+	}
+}
+
+// openAPIOperation builds the OpenAPI operation object for the endpoint.
+func openAPIOperation(table Table, endpoint Endpoint) map[string]interface{} {
+	op := map[string]interface{}{
+		"summary":     endpoint.Desc,
+		"operationId": endpoint.Callback,
+		"tags":        []string{table.Name},
+	}
+
+	// Every URL parameter is a required string in the path.
+	var params []interface{}
+	for _, param := range urlParams(endpoint.URL) {
+		params = append(params, map[string]interface{}{
+			"name":     param,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	if len(endpoint.Request) > 0 {
+		op["requestBody"] = map[string]interface{}{
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": Schema(endpoint.Request),
+				},
+			},
+		}
+	}
+
+	response := map[string]interface{}{"description": "Success"}
+	if len(endpoint.Response) > 0 {
+		response["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": Schema(endpoint.Response),
+			},
+		}
+	}
+	op["responses"] = map[string]interface{}{
+		"2XX": response,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"error": map[string]interface{}{"type": "string"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return op
+}
+
+// Schema converts a field description from an Endpoint's Request or Response into a JSON schema.
+// See Endpoint for the accepted forms.
+func Schema(field interface{}) map[string]interface{} {
+	switch v := field.(type) {
+	case map[string]interface{}:
+		// A map with a "type" string describes a single value.
+		if t, ok := v["type"].(string); ok {
+			schema := map[string]interface{}{"type": t}
+			if desc, ok := v["description"].(string); ok {
+				schema["description"] = desc
+			}
+			return schema
+		}
+
+		// Otherwise, this is an object. Keys that begin with a colon stand for any key.
+		schema := map[string]interface{}{"type": "object"}
+		props := make(map[string]interface{})
+		for key, value := range v {
+			if strings.HasPrefix(key, ":") {
+				schema["additionalProperties"] = Schema(value)
+			} else {
+				props[key] = Schema(value)
+			}
+		}
+		if len(props) > 0 {
+			schema["properties"] = props
+		}
+		return schema
+
+	case []interface{}:
+		schema := map[string]interface{}{"type": "array"}
+		if len(v) > 0 {
+			schema["items"] = Schema(v[0])
+		}
+		return schema
+
+	case string:
+		// A plain string is a description of a string value.
+		return map[string]interface{}{"type": "string", "description": v}
+	}
+
+	return map[string]interface{}{}
+}
+
+// openAPIPath converts a Gin-style URL (e.g. "/routines/:routine") into an OpenAPI path (e.g.
+// "/routines/{routine}").
+func openAPIPath(url string) string {
+	parts := strings.Split(url, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+
+	return strings.Join(parts, "/")
+}
+
+// urlParams returns the names of the parameters in a Gin-style URL.
+func urlParams(url string) []string {
+	var params []string
+	for _, part := range strings.Split(url, "/") {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			params = append(params, part[1:])
+		}
+	}
+
+	return params
+}
+
+// docsTemplate is the template for the documentation page.
+var docsTemplate = template.Must(template.New("docs").Funcs(template.FuncMap{
+	"json": func(v interface{}) string {
+		b, _ := json.MarshalIndent(v, "", "  ")
+		return string(b)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; padding: 0 1em; color: #222; }
+h2 { border-bottom: 1px solid #ccc; }
+.endpoint { margin: 1em 0 2em; }
+.method { display: inline-block; min-width: 5em; font-weight: bold; }
+pre { background: #f4f4f4; padding: 0.5em; overflow-x: auto; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<p>{{.Desc}}</p>
+<p>Version {{printf "%.1f" .Version}}. The OpenAPI document is available at <a href="{{.Prefix}}/openapi.json">{{.Prefix}}/openapi.json</a>.</p>
+{{range .Tables}}
+<h2>{{.Name}}</h2>
+<p>{{.Desc}}</p>
+{{range .Endpoints}}
+<div class="endpoint">
+<h3><span class="method">{{.Method}}</span> <code>{{$.Prefix}}{{.URL}}</code></h3>
+<p>{{.Desc}}</p>
+{{if .Request}}<h4>Request</h4><pre>{{json .Request}}</pre>{{end}}
+{{if .Response}}<h4>Response</h4><pre>{{json .Response}}</pre>{{end}}
+</div>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// serveOpenAPI writes the specification as an OpenAPI 3 document.
+func serveOpenAPI(w http.ResponseWriter, spec RestSpec) {
+	b, err := json.Marshal(spec.OpenAPI())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// serveDocs writes the documentation page for the specification.
+func serveDocs(w http.ResponseWriter, spec RestSpec) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := docsTemplate.Execute(w, spec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
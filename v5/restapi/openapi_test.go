@@ -0,0 +1,110 @@
+package restapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/snhilde/statusbar/v5/restapi"
+)
+
+type testHandler struct{}
+
+func (testHandler) HandleGetItem(_ restapi.Endpoint, params restapi.Params, _ *http.Request) (int, string) {
+	return 200, `{"item":"` + params["item"] + `"}`
+}
+
+var testSpec = `
+{
+	"name": "Test API",
+	"prefix": "/api/v1",
+	"version": 1.0,
+	"tables": [
+		{
+			"name": "items",
+			"endpoints": [
+				{
+					"method": "GET",
+					"url": "/items/:item",
+					"description": "Get an item.",
+					"response": {
+						"items": {
+							":item": {
+								"size": {"type": "number", "description": "Item's size"}
+							}
+						},
+						"tags": ["Tag name"]
+					},
+					"callback": "HandleGetItem"
+				}
+			]
+		}
+	]
+}
+`
+
+func TestOpenAPI(t *testing.T) {
+	t.Parallel()
+
+	e := restapi.NewEngine()
+	e.EnableDocs()
+	if err := e.AddSpecReader(strings.NewReader(testSpec), testHandler{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if specs := e.Specs(); len(specs) != 1 || specs[0].Name != "Test API" {
+		t.Fatalf("unexpected specs: %v", specs)
+	}
+
+	w := httptest.NewRecorder()
+	e.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/openapi.json", nil))
+	if w.Code != 200 {
+		t.Fatalf("openapi.json: got status %d", w.Code)
+	}
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+			Parameters  []struct {
+				Name string `json:"name"`
+				In   string `json:"in"`
+			} `json:"parameters"`
+			Responses map[string]struct {
+				Content map[string]struct {
+					Schema json.RawMessage `json:"schema"`
+				} `json:"content"`
+			} `json:"responses"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	op, ok := doc.Paths["/api/v1/items/{item}"]["get"]
+	if !ok {
+		t.Fatalf("missing operation: %s", w.Body.String())
+	}
+	if op.OperationID != "HandleGetItem" {
+		t.Errorf("operationId: got %q", op.OperationID)
+	}
+	if len(op.Parameters) != 1 || op.Parameters[0].Name != "item" || op.Parameters[0].In != "path" {
+		t.Errorf("unexpected parameters: %+v", op.Parameters)
+	}
+
+	want := `{"properties":{` +
+		`"items":{"additionalProperties":{"properties":{"size":{"description":"Item's size","type":"number"}},` +
+		`"type":"object"},"type":"object"},` +
+		`"tags":{"items":{"description":"Tag name","type":"string"},"type":"array"}},"type":"object"}`
+	if got := string(op.Responses["2XX"].Content["application/json"].Schema); got != want {
+		t.Errorf("schema:\ngot  %s\nwant %s", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	e.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/docs", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "/api/v1/items/:item") {
+		t.Errorf("docs: got status %d", w.Code)
+	}
+}
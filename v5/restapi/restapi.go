@@ -10,22 +10,54 @@
 // object and importing that directly or by using an unmarshaled structure.
 //
 // To begin, review the notes on RestSpec and craft your implementation, making sure that every
-// Endpoint's Callback implements HandlerFunc. Next, create a new Engine and import the
-// specification using the appropriate AddSpec* helper (AddSpec to add a RestSpec structure
-// directly, AddSpecFile to import a file containing the JSON representation of the spec, or
-// AddSpecReader to use an io.Reader that wraps the JSON object for the spec). Finally, run the
+// Endpoint's Callback implements HandlerFunc (or ResponseFunc, for setting headers and streaming
+// response data, or StreamFunc, for writing the response directly). Next, create a new Engine and
+// import the specification using the appropriate AddSpec* helper (AddSpec to add a RestSpec
+// structure directly, AddSpecFile to import a file containing the JSON representation of the spec,
+// or AddSpecReader to use an io.Reader that wraps the JSON object for the spec). Finally, run the
 // engine with Run. The Gin engine now handles the REST API routing, mapping URLs to Callbacks.
+//
+// If several handlers need the same routes for different items, e.g. "/items/:item/refresh" for
+// each item, then add a specification for each item with AddSpecFor. Requests are routed to the
+// handler that was added for the item in the URL.
+//
+// Request bodies are checked against each Endpoint's Request fields before the Callback is called.
+// Requests that don't match are rejected with a 400 response that lists the offending fields, like
+// this:
+//	{"error": "invalid request", "code": "invalid_request", "fields": [{"field": "interval", "message": "must be an integer"}]}
+// In debug mode (see SetDebug), responses are checked against the Response fields as well.
+//
+// By default, the engine listens only on the loopback interface and does not require
+// authentication. Use SetAddress to listen elsewhere and AddToken to require a bearer token, which
+// can be limited to read-only access. The engine can also listen on Unix sockets with RunUnix, where
+// access is controlled by the socket's file permissions, and serve HTTPS with SetTLS.
+//
+// A typed Go client for a specification can be generated with the clientgen package.
+//
+// Middleware can be added with Use to act on every request before it is routed. The package
+// provides middleware for CORS, request IDs (RequestIDs), JSON access logs (AccessLog), and
+// per-client rate limiting (RateLimit), and any func(http.Handler) http.Handler works as well.
+//
+// Every specification that is added is also served as an OpenAPI 3 document at
+// "<prefix>/openapi.json". If EnableDocs is called before adding a specification, then a
+// human-readable documentation page is served for it at "<prefix>/docs" as well.
 package restapi
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
 	"os"
 	"reflect"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -35,7 +67,45 @@ import (
 // REST API according to the specifications provided.
 type Engine struct {
 	engine *gin.Engine
-	server *http.Server
+
+	// Protects the listeners, which can be changed while the engine is running.
+	mutex sync.Mutex
+
+	// Server listening on TCP, as started with Run, and its listener and address.
+	server   *http.Server
+	listener net.Listener
+	addr     string
+
+	// Error that stopped the TCP server, if it stopped on its own.
+	serveErr error
+
+	// Servers listening on Unix sockets, as started with RunUnix, keyed by socket path.
+	unixServers map[string]*http.Server
+
+	// Certificate and key files to use for TLS on TCP, as set with SetTLS.
+	certFile string
+	keyFile  string
+
+	// Specifications that have been added to the engine, in the order they were added.
+	specs []RestSpec
+
+	// Whether or not to serve a documentation page for each specification.
+	docs bool
+
+	// Whether or not to check responses against the specification, as set with SetDebug.
+	debug bool
+
+	// Host to listen on, as set with SetAddress.
+	host string
+
+	// Tokens that grant access to the API, as added with AddToken.
+	tokens []token
+
+	// Routes shared by specifications added with AddSpecFor, keyed by method and full path.
+	mounts map[string]*mount
+
+	// Middleware to wrap the engine in, as added with Use, from outermost to innermost.
+	middleware []Middleware
 }
 
 // Params is a map of REST path parameters to their values. For example, if a path is specified as
@@ -55,6 +125,38 @@ type Params map[string]string
 // string of response data.
 type HandlerFunc func(Endpoint, Params, *http.Request) (int, string)
 
+// StreamFunc is the function definition for callbacks that need to write their response directly,
+// such as long-lived streams of events. It is used in place of HandlerFunc. For example, a Callback
+// of "StreamUpdates" would need to implement StreamUpdates(Endpoint, Params, http.ResponseWriter,
+// *http.Request). The method owns the response until it returns, and it should return when the
+// request's context is done (i.e. the client has disconnected). The engine still checks tokens for
+// these endpoints, but it does not validate their requests or responses.
+type StreamFunc func(Endpoint, Params, http.ResponseWriter, *http.Request)
+
+// ResponseFunc is the function definition for callbacks that need more control over their response
+// than HandlerFunc gives, such as setting headers or streaming the response data. It is used in
+// place of HandlerFunc. For example, a Callback of "DownloadReport" would need to implement
+// DownloadReport(Endpoint, Params, *http.Request) Response. Unlike StreamFunc, requests and
+// responses are still validated (except for streamed response data).
+type ResponseFunc func(Endpoint, Params, *http.Request) Response
+
+// Response is the response that a ResponseFunc returns.
+type Response struct {
+	// HTTP response code.
+	Code int
+
+	// Headers to add to the response. If this does not set "Content-Type", then the engine sets it
+	// to "application/json" for JSON data.
+	Header http.Header
+
+	// Response data.
+	Body string
+
+	// Reader to stream the response data from, in place of Body. The data is sent to the client as
+	// it is read. If the reader is also an io.Closer, then it is closed afterward.
+	Stream io.Reader
+}
+
 // RestSpec is the data model for the REST API specification. To implement the REST API, you build
 // out a JSON object following this model and import it using an AddSpec* helper.
 type RestSpec struct {
@@ -99,26 +201,105 @@ type Endpoint struct {
 	// Description of this endpoint.
 	Desc string `json:"description"`
 
-	// Map of key/value pairs for request data.
+	// Map of key/value pairs for request data. Each value describes a field in one of these forms:
+	//   - An object with a "type" key ("string", "number", "boolean", etc.) and an optional
+	//     "description" key describes a single value.
+	//   - Any other object describes a nested object. A key beginning with a colon (like ":routine")
+	//     stands for any key, e.g. a map of routine names to their information.
+	//   - An array with one element describes a list of that element.
+	//   - A string describes a string value, with the string as its description.
 	Request map[string]interface{} `json:"request"`
 
-	// Map of key/value pairs in response data.
+	// Map of key/value pairs in response data. This uses the same forms as Request.
 	Response map[string]interface{} `json:"response"`
 
 	// Handler callback that is called to handle this endpoint's implementation. See the HandlerFunc
 	// type for more information on this.
 	Callback string `json:"callback"`
+
+	// Name of this endpoint's method in generated clients, e.g. "Refresh". If this is empty, then
+	// the Callback is used without its "Handle" prefix. See the clientgen package for more.
+	Operation string `json:"operation,omitempty"`
+
+	// Scope that a token needs to access this endpoint, either "read" or "write". If this is empty,
+	// then GET, HEAD, and OPTIONS endpoints need "read", and all other endpoints need "write". This
+	// only matters if tokens have been added with AddToken.
+	Scope Scope `json:"scope,omitempty"`
 }
 
+// defaultHost is the host that the engine listens on if SetAddress is not called.
+const defaultHost = "127.0.0.1"
+
 // NewEngine creates a new Engine using Gin's default engine, which includes fault handling and
-// logging.
+// logging. The engine listens only on the loopback interface unless SetAddress is called.
 func NewEngine() *Engine {
 	e := new(Engine)
 	e.engine = gin.Default()
+	e.host = defaultHost
 
 	return e
 }
 
+// EnableDocs enables a documentation page for each specification added after this is called. The
+// page is served at "<prefix>/docs".
+func (e *Engine) EnableDocs() {
+	if e != nil {
+		e.docs = true
+	}
+}
+
+// SetAddress sets the host or IP address to listen on, e.g. "0.0.0.0" to listen on all IPv4
+// interfaces or "::" for all interfaces. This must be called before Run. The default is "127.0.0.1",
+// which only accepts connections from the local machine.
+func (e *Engine) SetAddress(host string) {
+	if e != nil {
+		e.host = host
+	}
+}
+
+// Use adds middleware that wraps every request the engine serves, such as CORS, RequestIDs,
+// AccessLog, or RateLimit. Middleware runs before routing and authentication, in the order it was
+// added, so the first middleware added sees each request first. This must be called before Run or
+// RunUnix.
+func (e *Engine) Use(middleware ...Middleware) {
+	if e != nil {
+		e.middleware = append(e.middleware, middleware...)
+	}
+}
+
+// handler returns the engine wrapped in its middleware.
+func (e *Engine) handler() http.Handler {
+	var h http.Handler = e.engine
+	for i := len(e.middleware) - 1; i >= 0; i-- {
+		h = e.middleware[i](h)
+	}
+
+	return h
+}
+
+// SetDebug turns debug mode on or off. In debug mode, every JSON response is also checked against
+// its endpoint's Response fields. If a response does not match, then the mismatch is logged and the
+// client receives a 500 response listing the offending fields. This is meant for catching mistakes
+// in handlers and specifications during development.
+func (e *Engine) SetDebug(enable bool) {
+	if e != nil {
+		e.debug = enable
+	}
+}
+
+// Specs returns the specifications that have been added to the engine, in the order they were
+// added.
+func (e *Engine) Specs() []RestSpec {
+	if e == nil {
+		return nil
+	}
+
+	specs := make([]RestSpec, len(e.specs))
+	copy(specs, e.specs)
+
+	return specs
+}
+
 // AddSpec adds the enpoints in the specification to Engine's routes.
 func (e *Engine) AddSpec(spec RestSpec, handler interface{}) error {
 	if e == nil || e.engine == nil {
@@ -133,13 +314,33 @@ func (e *Engine) AddSpec(spec RestSpec, handler interface{}) error {
 	// Map the endpoints into the engine.
 	for _, table := range spec.Tables {
 		for _, endpoint := range table.Endpoints {
+			if endpoint.Scope != "" && endpoint.Scope != ScopeRead && endpoint.Scope != ScopeWrite {
+				return fmt.Errorf("invalid scope for %s: %s", endpoint.URL, endpoint.Scope)
+			}
+
 			// Register this endpoint with this group.
-			if err := registerEndpoint(handler, group, endpoint); err != nil {
+			if err := e.registerEndpoint(handler, group, endpoint); err != nil {
 				return err
 			}
 		}
 	}
 
+	// Serve the specification itself.
+	group.GET("/openapi.json", func(c *gin.Context) {
+		if e.authorize(c, ScopeRead) {
+			serveOpenAPI(c.Writer, spec)
+		}
+	})
+	if e.docs {
+		group.GET("/docs", func(c *gin.Context) {
+			if e.authorize(c, ScopeRead) {
+				serveDocs(c.Writer, spec)
+			}
+		})
+	}
+
+	e.specs = append(e.specs, spec)
+
 	return nil
 }
 
@@ -163,45 +364,90 @@ func (e *Engine) AddSpecFile(path string, handler interface{}) error {
 // AddSpecReader reads the REST API specification in r and adds it to Engine's routes. The
 // specification must be JSON-encoded using the template defined in RestSpec.
 func (e *Engine) AddSpecReader(r io.Reader, handler interface{}) error {
+	spec, err := ParseSpec(r)
+	if err != nil {
+		return err
+	}
+
+	return e.AddSpec(spec, handler)
+}
+
+// ParseSpec reads the JSON-encoded REST API specification in r, using the template defined in
+// RestSpec.
+func ParseSpec(r io.Reader) (RestSpec, error) {
 	// Unmarshal JSON in reader.
 	spec := RestSpec{}
 	decoder := json.NewDecoder(r)
 	if err := decoder.Decode(&spec); err != nil && !errors.Is(err, io.EOF) {
-		return err
+		return RestSpec{}, err
 	}
 
-	return e.AddSpec(spec, handler)
+	return spec, nil
 }
 
-// Run runs the API engine in a new goroutine and listens on the designated port.
-func (e *Engine) Run(port int) {
-	if e != nil && e.engine != nil && e.server == nil {
-		// We need to create a new server on every call to Run because a server cannot be reused
-		// after a call to Stop.
-		e.server = new(http.Server)
-		e.server.Handler = e.engine
-		e.server.Addr = fmt.Sprintf(":%d", port)
+// Run runs the API engine in a new goroutine and listens on the designated port. If SetTLS was
+// called, then the engine serves HTTPS on the port. Errors binding to the port (e.g. if the port is
+// already in use) or loading the certificate are returned right away. Errors that stop the engine
+// later on are reported by Health.
+func (e *Engine) Run(port int) error {
+	if e == nil || e.engine == nil {
+		return fmt.Errorf("invalid Engine")
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
 
-		go e.server.ListenAndServe()
+	if e.server != nil {
+		return fmt.Errorf("already listening on %s", e.addr)
 	}
+
+	return e.listen(net.JoinHostPort(e.host, strconv.Itoa(port)))
 }
 
-// Stop stops the API engine in timeout seconds.
+// Stop stops the API engine in timeout seconds. This stops every listener, including Unix sockets.
 func (e *Engine) Stop(timeout int) error {
-	if e == nil || e.server == nil {
+	if e == nil {
+		return fmt.Errorf("invalid server")
+	}
+
+	// Take the servers out of the engine first, so that requests that are still being handled don't
+	// wait on us while we wait on them.
+	e.mutex.Lock()
+	server := e.server
+	unixServers := e.unixServers
+	e.server = nil
+	e.listener = nil
+	e.addr = ""
+	e.unixServers = nil
+	e.mutex.Unlock()
+
+	if server == nil && len(unixServers) == 0 {
 		return fmt.Errorf("invalid server")
 	}
 
-	// Give the engine 5 seconds to close out any connections.
+	// Give the engine the timeout to close out any connections.
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
 	defer cancel()
 
-	err := e.server.Shutdown(ctx)
-	e.server = nil
+	var err error
+	if server != nil {
+		err = server.Shutdown(ctx)
+	}
+
+	for path, server := range unixServers {
+		if serr := server.Shutdown(ctx); serr != nil && err == nil {
+			err = serr
+		}
+		os.Remove(path)
+	}
+
 	return err
 }
 
-func registerEndpoint(handler interface{}, group *gin.RouterGroup, endpoint Endpoint) error {
+// registerEndpoint registers the endpoint with the group, using the method of handler named in the
+// endpoint's Callback. If the endpoint describes its request fields, then request bodies are checked
+// against them before the method is called.
+func (e *Engine) registerEndpoint(handler interface{}, group *gin.RouterGroup, endpoint Endpoint) error {
 	// Get the underlying type of the handler.
 	handlerType := reflect.ValueOf(handler)
 
@@ -212,32 +458,157 @@ func registerEndpoint(handler interface{}, group *gin.RouterGroup, endpoint Endp
 	}
 
 	// Register the endpoint.
-	group.Handle(endpoint.Method, endpoint.URL, func(c *gin.Context) {
+	group.Handle(endpoint.Method, endpoint.URL, e.endpointHandler(method, endpoint, nil))
+
+	return nil
+}
+
+// endpointHandler builds the Gin handler that calls method, which must be a HandlerFunc,
+// ResponseFunc, or StreamFunc, for the endpoint. If done is not nil, then it is called with the
+// response code after a HandlerFunc or ResponseFunc method returns.
+func (e *Engine) endpointHandler(method interface{}, endpoint Endpoint, done func(Endpoint, int)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !e.authorize(c, endpoint.requiredScope()) {
+			return
+		}
+
 		params := make(Params)
 		for _, p := range c.Params {
 			params[p.Key] = p.Value
 		}
 
-		code, output := method(endpoint, params, c.Request)
-		if code >= 400 && code < 600 {
-			c.Error(fmt.Errorf(output))
+		var respond func(Endpoint, Params, *http.Request) Response
+		switch m := method.(type) {
+		case func(Endpoint, Params, http.ResponseWriter, *http.Request):
+			m(endpoint, params, c.Writer, c.Request)
+			return
+		case func(Endpoint, Params, *http.Request) Response:
+			respond = m
+		case func(Endpoint, Params, *http.Request) (int, string):
+			respond = func(endpoint Endpoint, params Params, request *http.Request) Response {
+				code, output := m(endpoint, params, request)
+				return Response{Code: code, Body: output}
+			}
 		}
 
-		if output == "" {
-			c.Status(code)
-		} else {
-			if json.Valid([]byte(output)) {
-				c.Header("Content-Type", "application/json")
-			}
+		if code, output := validateRequest(endpoint, c.Request); code != 0 {
+			c.Error(fmt.Errorf("invalid request"))
+			c.Header("Content-Type", "application/json")
 			c.String(code, output)
+			return
 		}
-	})
 
-	return nil
+		resp := respond(endpoint, params, c.Request)
+		if closer, ok := resp.Stream.(io.Closer); ok {
+			defer closer.Close()
+		}
+		if e.debug && resp.Code < 300 && resp.Stream == nil {
+			resp.Code, resp.Body = validateResponse(endpoint, resp.Code, resp.Body)
+		}
+		if resp.Code >= 400 && resp.Code < 600 {
+			c.Error(errors.New(resp.Body))
+		}
+
+		writeResponse(c, resp)
+
+		if done != nil {
+			done(endpoint, resp.Code)
+		}
+	}
+}
+
+// writeResponse sends the response to the client.
+func writeResponse(c *gin.Context, resp Response) {
+	header := c.Writer.Header()
+	for key, values := range resp.Header {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+
+	switch {
+	case resp.Stream != nil:
+		c.Status(resp.Code)
+		c.Writer.WriteHeaderNow()
+		io.Copy(flushWriter{c.Writer}, resp.Stream)
+	case resp.Body == "":
+		c.Status(resp.Code)
+	default:
+		if header.Get("Content-Type") == "" && json.Valid([]byte(resp.Body)) {
+			header.Set("Content-Type", "application/json")
+		}
+		c.Writer.WriteHeader(resp.Code)
+		c.Writer.WriteString(resp.Body)
+	}
+}
+
+// flushWriter flushes every write through to the client right away.
+type flushWriter struct {
+	w gin.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.w.Flush()
+	return n, err
+}
+
+// validateRequest checks the request's body against the endpoint's Request fields. If the body is
+// valid (or there is nothing to check), then this returns a code of 0. Otherwise, it returns the
+// HTTP response code and the error response. The body is left in place for the handler to read.
+func validateRequest(endpoint Endpoint, request *http.Request) (int, string) {
+	if len(endpoint.Request) == 0 || request.Body == nil {
+		return 0, ""
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	request.Body.Close()
+	if err != nil {
+		return 400, encodeError(errorResponse{Error: err.Error(), Code: "invalid_request"})
+	}
+	request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	// Let the handler decide what to do with an empty body.
+	if len(bytes.TrimSpace(body)) == 0 {
+		return 0, ""
+	}
+
+	if errs := Validate(endpoint.Request, body); len(errs) > 0 {
+		return 400, encodeError(errorResponse{Error: "invalid request", Code: "invalid_request", Fields: errs})
+	}
+
+	return 0, ""
+}
+
+// validateResponse checks the handler's output against the endpoint's Response fields. Output that
+// is not JSON is not checked. If the output is valid, then the code and output are returned as-is.
+// Otherwise, the mismatch is logged and an error response is returned in their place.
+func validateResponse(endpoint Endpoint, code int, output string) (int, string) {
+	if len(endpoint.Response) == 0 || !json.Valid([]byte(output)) {
+		return code, output
+	}
+
+	errs := Validate(endpoint.Response, []byte(output))
+	if len(errs) == 0 {
+		return code, output
+	}
+
+	for _, err := range errs {
+		log.Printf("%s %s: invalid response field %q: %s", endpoint.Method, endpoint.URL, err.Field, err.Message)
+	}
+
+	return 500, encodeError(errorResponse{Error: "invalid response", Code: "invalid_response", Fields: errs})
+}
+
+// encodeError encodes the error response as JSON.
+func encodeError(v errorResponse) string {
+	b, _ := json.Marshal(v)
+	return string(b)
 }
 
-// findMethod parses the endpoint and finds and validates the handler method specified.
-func findMethod(handlerType reflect.Value, endpoint Endpoint) (func(Endpoint, Params, *http.Request) (int, string), error) {
+// findMethod parses the endpoint and finds and validates the handler method specified. The method is
+// returned as a HandlerFunc, ResponseFunc, or StreamFunc.
+func findMethod(handlerType reflect.Value, endpoint Endpoint) (interface{}, error) {
 	if endpoint.Callback == "" {
 		return nil, fmt.Errorf("missing callback for %s", endpoint.URL)
 	}
@@ -248,11 +619,14 @@ func findMethod(handlerType reflect.Value, endpoint Endpoint) (func(Endpoint, Pa
 	}
 
 	// Type assert the callback method back to the correct definition.
-	iface := method.Interface()
-	f, ok := iface.(func(Endpoint, Params, *http.Request) (int, string))
-	if !ok {
-		return nil, fmt.Errorf("%s does not satisfy HandlerFunc", endpoint.Callback)
+	switch f := method.Interface().(type) {
+	case func(Endpoint, Params, *http.Request) (int, string):
+		return f, nil
+	case func(Endpoint, Params, *http.Request) Response:
+		return f, nil
+	case func(Endpoint, Params, http.ResponseWriter, *http.Request):
+		return f, nil
 	}
 
-	return f, nil
+	return nil, fmt.Errorf("%s does not satisfy HandlerFunc, ResponseFunc, or StreamFunc", endpoint.Callback)
 }
@@ -0,0 +1,75 @@
+package restapi_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/snhilde/statusbar/v5/restapi"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+type responseHandler struct{}
+
+func (responseHandler) HandleGetReport(_ restapi.Endpoint, params restapi.Params, _ *http.Request) restapi.Response {
+	header := make(http.Header)
+	header.Set("Content-Type", "text/csv")
+	header.Set("Content-Disposition", `attachment; filename="report.csv"`)
+
+	return restapi.Response{Code: 200, Header: header, Stream: ioutil.NopCloser(strings.NewReader("a,b\n1,2\n"))}
+}
+
+func (responseHandler) HandleGetItem(_ restapi.Endpoint, params restapi.Params, _ *http.Request) restapi.Response {
+	header := make(http.Header)
+	header.Set("ETag", `"`+params["item"]+`"`)
+
+	return restapi.Response{Code: 200, Header: header, Body: `{"item":"` + params["item"] + `"}`}
+}
+
+func TestResponseFunc(t *testing.T) {
+	t.Parallel()
+
+	spec := restapi.RestSpec{
+		Prefix: "/api",
+		Tables: []restapi.Table{{Endpoints: []restapi.Endpoint{
+			{Method: "GET", URL: "/report", Callback: "HandleGetReport"},
+			{Method: "GET", URL: "/items/:item", Callback: "HandleGetItem"},
+		}}},
+	}
+
+	e := restapi.NewEngine()
+	if err := e.AddSpec(spec, responseHandler{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url    string
+		header string
+		value  string
+		body   string
+	}{
+		{"/api/report", "Content-Type", "text/csv", "a,b\n1,2\n"},
+		{"/api/report", "Content-Disposition", `attachment; filename="report.csv"`, "a,b\n1,2\n"},
+		{"/api/items/a", "Content-Type", "application/json", `{"item":"a"}`},
+		{"/api/items/a", "ETag", `"a"`, `{"item":"a"}`},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		e.Handler().ServeHTTP(w, httptest.NewRequest("GET", test.url, nil))
+		if w.Code != 200 || w.Body.String() != test.body {
+			t.Errorf("%s: got %d %q, want 200 %q", test.url, w.Code, w.Body.String(), test.body)
+		}
+		if got := w.Header().Get(test.header); got != test.value {
+			t.Errorf("%s: got %s %q, want %q", test.url, test.header, got, test.value)
+		}
+	}
+}
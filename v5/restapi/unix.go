@@ -0,0 +1,100 @@
+// This file contains the logic for serving the API over Unix domain sockets and TLS.
+
+package restapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unixConnKey is the context key that marks requests that arrived over a Unix socket.
+type unixConnKey struct{}
+
+// RunUnix runs the API engine in a new goroutine and listens on a Unix domain socket at path. The
+// socket file is created with the permissions in perm (e.g. 0600 to allow only the current user,
+// or 0660 to also allow the file's group), and access is controlled by those permissions alone:
+// requests over the socket do not need a token, even if tokens have been added with AddToken. The
+// directory holding the socket is created if needed. If a socket file already exists at path, then
+// it is replaced. This can be used alongside Run.
+func (e *Engine) RunUnix(path string, perm os.FileMode) error {
+	if e == nil || e.engine == nil {
+		return fmt.Errorf("invalid Engine")
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if _, ok := e.unixServers[path]; ok {
+		return fmt.Errorf("already listening on %s", path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	// Clean out any socket left behind by a previous run. We don't want to remove anything that
+	// isn't a socket, though.
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(path, perm); err != nil {
+		listener.Close()
+		os.Remove(path)
+		return err
+	}
+
+	server := new(http.Server)
+	server.Handler = e.handler()
+	server.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		return context.WithValue(ctx, unixConnKey{}, true)
+	}
+
+	if e.unixServers == nil {
+		e.unixServers = make(map[string]*http.Server)
+	}
+	e.unixServers[path] = server
+
+	go server.Serve(listener)
+
+	return nil
+}
+
+// SetTLS sets the certificate and key files to use for serving HTTPS. This applies to the TCP
+// listener started with Run, which must be called after this. Unix sockets do not use TLS.
+func (e *Engine) SetTLS(certFile, keyFile string) error {
+	if e == nil {
+		return fmt.Errorf("invalid Engine")
+	}
+
+	if certFile == "" || keyFile == "" {
+		return fmt.Errorf("missing certificate or key file")
+	}
+
+	e.certFile = certFile
+	e.keyFile = keyFile
+
+	return nil
+}
+
+// isUnixConn checks whether or not the request arrived over a Unix socket.
+func isUnixConn(c *gin.Context) bool {
+	v, _ := c.Request.Context().Value(unixConnKey{}).(bool)
+	return v
+}
@@ -0,0 +1,70 @@
+package restapi_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/snhilde/statusbar/v5/restapi"
+)
+
+func TestRunUnix(t *testing.T) {
+	t.Parallel()
+
+	spec := restapi.RestSpec{
+		Prefix: "/api",
+		Tables: []restapi.Table{{Endpoints: []restapi.Endpoint{
+			{Method: "DELETE", URL: "/items/:item", Callback: "HandleGetItem"},
+		}}},
+	}
+
+	e := restapi.NewEngine()
+	if err := e.AddToken("writer", restapi.ScopeWrite); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddSpec(spec, testHandler{}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "run", "api.sock")
+	if err := e.RunUnix(path, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0o600 {
+		t.Errorf("unexpected mode: %v", info.Mode())
+	}
+
+	// Requests over the socket don't need a token.
+	client := http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial("unix", path)
+		},
+	}}
+	r, err := http.NewRequest("DELETE", "http://unix/api/items/a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d", resp.StatusCode)
+	}
+
+	if err := e.Stop(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket was not removed: %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+// This file contains the logic for validating request and response data against the specification.
+
+package restapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// FieldError describes a single field that does not match the specification.
+type FieldError struct {
+	// Path to the field, e.g. "routines.sbcpuusage.interval" or "tags[2]".
+	Field string `json:"field"`
+
+	// What is wrong with the field.
+	Message string `json:"message"`
+}
+
+// errorResponse is the response body that is sent when the engine rejects a request.
+type errorResponse struct {
+	// Summary of the error.
+	Error string `json:"error"`
+
+	// Short, machine-readable code for the error, e.g. "invalid_request".
+	Code string `json:"code"`
+
+	// List of fields that did not pass validation, if that is why the request was rejected.
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// Validate checks the JSON-encoded data against the fields of a Request or Response (see Endpoint
+// for how the fields are described). Only fields that are present are checked, so a field that is
+// missing is not an error. Fields that are not in the specification are errors. If the data is
+// valid, then this returns nil.
+func Validate(fields map[string]interface{}, data []byte) []FieldError {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return []FieldError{{Field: "", Message: "invalid JSON: " + err.Error()}}
+	}
+
+	var errs []FieldError
+	validateField(fields, value, "", &errs)
+
+	return errs
+}
+
+// validateField checks value against field and appends any errors to errs. path is the path to the
+// value, used for the error messages.
+func validateField(field interface{}, value interface{}, path string, errs *[]FieldError) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, FieldError{Field: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch f := field.(type) {
+	case map[string]interface{}:
+		// A map with a "type" string describes a single value.
+		if t, ok := f["type"].(string); ok {
+			if !matchesType(t, value) {
+				fail("must be %s %s", article(t), t)
+			}
+			return
+		}
+
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			fail("must be an object")
+			return
+		}
+
+		// Find the wildcard key, if there is one.
+		var wildcard interface{}
+		for key, sub := range f {
+			if strings.HasPrefix(key, ":") {
+				wildcard = sub
+				break
+			}
+		}
+
+		// Check the keys in sorted order so that the errors are always reported the same way.
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			sub, ok := f[key]
+			if !ok {
+				if wildcard == nil {
+					*errs = append(*errs, FieldError{Field: joinPath(path, key), Message: "unknown field"})
+					continue
+				}
+				sub = wildcard
+			}
+			validateField(sub, obj[key], joinPath(path, key), errs)
+		}
+
+	case []interface{}:
+		list, ok := value.([]interface{})
+		if !ok {
+			fail("must be an array")
+			return
+		}
+
+		if len(f) > 0 {
+			for i, item := range list {
+				validateField(f[0], item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+
+	case string:
+		if _, ok := value.(string); !ok {
+			fail("must be a string")
+		}
+	}
+}
+
+// matchesType checks whether or not the decoded JSON value is of the named type.
+func matchesType(t string, value interface{}) bool {
+	switch t {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	}
+
+	// We don't know how to check any other types.
+	return true
+}
+
+// joinPath adds the key to the path.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// article returns the indefinite article for the word.
+func article(word string) string {
+	if word != "" && strings.ContainsRune("aeiou", rune(word[0])) {
+		return "an"
+	}
+
+	return "a"
+}
@@ -0,0 +1,99 @@
+package restapi_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/snhilde/statusbar/v5/restapi"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	fields := map[string]interface{}{
+		"interval": map[string]interface{}{"type": "integer"},
+		"name":     map[string]interface{}{"type": "string"},
+		"routines": map[string]interface{}{
+			":routine": map[string]interface{}{
+				"active": map[string]interface{}{"type": "boolean"},
+			},
+		},
+		"tags": []interface{}{"Tag name"},
+	}
+
+	tests := []struct {
+		data string
+		want []restapi.FieldError
+	}{
+		{`{}`, nil},
+		{`{"interval": 5, "name": "cpu", "routines": {"sbcpuusage": {"active": true}}, "tags": ["a"]}`, nil},
+		{`{"interval": 1.5}`, []restapi.FieldError{
+			{Field: "interval", Message: "must be an integer"},
+		}},
+		{`{"interval": "5", "name": 5}`, []restapi.FieldError{
+			{Field: "interval", Message: "must be an integer"},
+			{Field: "name", Message: "must be a string"},
+		}},
+		{`{"routines": {"sbram": {"active": "yes", "extra": 1}}}`, []restapi.FieldError{
+			{Field: "routines.sbram.active", Message: "must be a boolean"},
+			{Field: "routines.sbram.extra", Message: "unknown field"},
+		}},
+		{`{"tags": ["a", 2]}`, []restapi.FieldError{{Field: "tags[1]", Message: "must be a string"}}},
+		{`{"bogus": 1}`, []restapi.FieldError{{Field: "bogus", Message: "unknown field"}}},
+		{`[]`, []restapi.FieldError{{Field: "", Message: "must be an object"}}},
+	}
+
+	for _, test := range tests {
+		if got := restapi.Validate(fields, []byte(test.data)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.data, got, test.want)
+		}
+	}
+
+	if errs := restapi.Validate(fields, []byte(`{"interval":`)); len(errs) != 1 {
+		t.Errorf("invalid JSON: got %v", errs)
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	t.Parallel()
+
+	spec := restapi.RestSpec{
+		Prefix: "/api",
+		Tables: []restapi.Table{{Endpoints: []restapi.Endpoint{{
+			Method:   "PATCH",
+			URL:      "/items/:item",
+			Request:  map[string]interface{}{"size": map[string]interface{}{"type": "number"}},
+			Response: map[string]interface{}{"item": map[string]interface{}{"type": "number"}},
+			Callback: "HandleGetItem",
+		}}}},
+	}
+
+	e := restapi.NewEngine()
+	if err := e.AddSpec(spec, testHandler{}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	e.Handler().ServeHTTP(w, httptest.NewRequest("PATCH", "/api/items/a", strings.NewReader(`{"size": "big"}`)))
+	want := `{"error":"invalid request","code":"invalid_request","fields":[{"field":"size","message":"must be a number"}]}`
+	if w.Code != http.StatusBadRequest || w.Body.String() != want {
+		t.Errorf("invalid request: got %d %s", w.Code, w.Body.String())
+	}
+
+	// The handler responds with a string for "item", which only matters in debug mode.
+	w = httptest.NewRecorder()
+	e.Handler().ServeHTTP(w, httptest.NewRequest("PATCH", "/api/items/a", strings.NewReader(`{"size": 3}`)))
+	if w.Code != http.StatusOK {
+		t.Errorf("valid request: got %d %s", w.Code, w.Body.String())
+	}
+
+	e.SetDebug(true)
+	w = httptest.NewRecorder()
+	e.Handler().ServeHTTP(w, httptest.NewRequest("PATCH", "/api/items/a", strings.NewReader(`{"size": 3}`)))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "invalid response") {
+		t.Errorf("invalid response: got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -4,9 +4,21 @@ package statusbar
 
 import (
 	"log"
+	"os"
+	"regexp"
+	"sync"
 	"time"
+
+	"github.com/snhilde/statusbar/v5/alert"
+	"github.com/snhilde/statusbar/v5/schedule"
 )
 
+// How often a routine's state is saved to the state store, at most.
+const saveInterval = time.Minute
+
+// colorCodes matches the color codes used by the status2d patch for dwm, like "^c#FFFFFF^" or "^d^".
+var colorCodes = regexp.MustCompile(`\^[^^]*\^`)
+
 // routine holds the data for an individual unit on the statusbar.
 type routine struct {
 	// Routine object that handles running the actual process
@@ -15,12 +27,23 @@ type routine struct {
 	// Name of routine
 	name string
 
+	// Unique identifier of the routine. This is the module name, with a number added if more than one routine uses
+	// the same module (e.g. "sbtime" and "sbtime-2").
+	id string
+
 	// Whether or not the routine is currently active and up.
 	active bool
 
+	// Protects the fields that can be read or changed by the engine and the APIs while the routine is running: whether
+	// or not it is active, the interval, the schedule, the display settings, and the results of the last update.
+	mutex sync.Mutex
+
 	// Time in seconds to wait between each run
 	intervalTime time.Duration
 
+	// Schedule to run on instead of the interval, if set
+	sched schedule.Schedule
+
 	// Timer that is started when the routine is started. This is used to measure the routine's uptime.
 	startTime time.Time
 
@@ -29,6 +52,65 @@ type routine struct {
 
 	// Channel to use for signaling stop
 	stopChan chan struct{}
+
+	// Record of the routine's most recent metrics, if the handler implements MetricsReporter.
+	history *history
+
+	// Current state of the routine. This is empty until the routine runs for the first time.
+	state string
+
+	// Dispatcher to send alerts to when the routine changes state.
+	alerts *alert.Dispatcher
+
+	// Feed to send state changes to.
+	feed *feed
+
+	// Store to save the routine's state to, if the handler implements Persister.
+	store *stateStore
+
+	// Time the routine's state was last saved to the store.
+	lastSave time.Time
+
+	// Routine's last good output, as returned by the handler's String method.
+	output string
+
+	// Routine's error message, as returned by the handler's Error method, if the last update failed.
+	errOutput string
+
+	// Whether or not the last update failed.
+	failed bool
+
+	// Whether or not the output was restored from the state store and hasn't been refreshed yet.
+	restored bool
+
+	// Time of the last successful update.
+	lastSuccess time.Time
+
+	// Time of the last failed update.
+	lastError time.Time
+
+	// Error returned by the last failed update.
+	lastErrorMsg string
+
+	// Number of failed updates since the routine was added.
+	errorCount int
+
+	// Display name to use instead of the handler's name, if set.
+	label string
+
+	// Region of the bar the routine is displayed in.
+	bar string
+
+	// Foreground and background colors to display the routine's output in, overriding the handler's own colors, if
+	// set.
+	fg string
+	bg string
+
+	// Whether or not the routine's scheduled updates are paused.
+	paused bool
+
+	// Channel that is closed when the routine's run loop exits.
+	done chan struct{}
 }
 
 // newRoutine returns a new routine object that is handled by handler.
@@ -38,39 +120,57 @@ func newRoutine() *routine {
 	// Set up the update and stop channels. We'll use a buffer size of 1 so the engine doesn't block sending on them.
 	r.updateChan = make(chan struct{}, 1)
 	r.stopChan = make(chan struct{}, 1)
+	r.bar = regionMain
 
 	return r
 }
 
-// run runs a routine in a non-terminating loop. The routine's output is stored in index in the string slice received
-// from outputsChan. If the routine does stop, it sends itself back on finished so the caller is aware.
-func (r *routine) run(index int, outputsChan chan []string, finished chan<- *routine) {
+// run runs a routine in a non-terminating loop. If the routine does stop, it sends itself back on finished so the
+// caller is aware.
+func (r *routine) run(finished chan<- *routine) {
 	if r == nil {
 		return
 	}
 
+	// A stop or update request can be left over from the last run if it came in while the loop was exiting on its own.
+	// Clear them out so that they don't stop or update the routine right away.
+	select {
+	case <-r.stopChan:
+	default:
+	}
+	select {
+	case <-r.updateChan:
+	default:
+	}
+
 	// Start the uptime clock.
+	done := make(chan struct{})
+	r.mutex.Lock()
 	r.startTime = time.Now()
-	r.setActive(true)
+	r.active = true
+	r.done = done
+	r.mutex.Unlock()
+	defer close(done)
+
+	// Show the output from the last time the statusbar ran until the first update finishes.
+	r.restore()
+
+	// Whether or not the engine asked for this update.
+	forced := false
 
 	for r.isActive() {
 		// Start the clock.
 		start := time.Now()
-
-		// Update the routine's data.
-		ok, err := r.handler.Update()
-
-		// Get the routine's output and store it in the master output slice.
-		var output string
-		if err == nil {
-			output = r.handler.String()
-		} else {
-			output = r.handler.Error()
-			log.Printf("%v: %v", r.handler.Name(), err.Error())
+		sched := r.getSchedule()
+
+		// Update the routine's data, unless the routine is paused or its schedule doesn't allow it right now. Updates
+		// requested by the engine always go through.
+		ok := true
+		var err error
+		if forced || (!r.isPaused() && schedule.Allowed(sched)) {
+			ok, err = r.runUpdate()
 		}
-		outputs := <-outputsChan
-		outputs[index] = output
-		outputsChan <- outputs
+		forced = false
 
 		// If the routine reported a critical error, then we'll break out of the loop now.
 		if !ok {
@@ -78,45 +178,142 @@ func (r *routine) run(index int, outputsChan chan []string, finished chan<- *rou
 		}
 
 		// If the interval was set to only run once, then we can close the routine now.
-		if r.intervalTime == 0 {
+		if sched == nil && r.interval() == 0 {
 			break
 		}
 
-		interval := r.intervalTime
-		// If the routine reported an error, then we'll give the process a little time to cool down before trying again.
-		if err != nil {
-			seconds := r.intervalTime / time.Second
-			switch {
-			// For routines with intervals up to 1 minute, sleep for 5 seconds.
-			case seconds < 60:
-				interval = 5 * time.Second
-			// For routines with intervals up to 15 minutes, sleep for 1 minute.
-			case seconds < 60*15:
-				interval = 60 * time.Second
-			// For routines with intervals longer than 15 minutes, sleep for 5 minutes.
-			default:
-				interval = 60 * 5 * time.Second
-			}
-		}
-
 		// Wait until either a signal is received from the engine or the time elapses for another update to run.
 		select {
 		case <-r.updateChan:
 			// Update now.
+			forced = true
 		case <-r.stopChan:
 			// Stop the routine.
 			r.setActive(false)
-		case <-time.After(interval - time.Since(start)):
+		case <-r.wait(start, sched, err):
 			// Time elapsed. Run another update loop.
 		}
 	}
 
 	r.setActive(false)
+	r.setState(StateStopped, "")
 
 	// Send on the finished channel to signify that we're stopping this routine.
 	finished <- r
 }
 
+// runUpdate runs the handler's Update and records the results. It returns the results of Update.
+func (r *routine) runUpdate() (bool, error) {
+	// Update the routine's data.
+	ok, err := r.handler.Update()
+	now := time.Now()
+
+	// Get the routine's output and store it for the engine.
+	if err == nil {
+		output := r.handler.String()
+		r.mutex.Lock()
+		r.output = output
+		r.failed = false
+		r.restored = false
+		r.lastSuccess = now
+		r.mutex.Unlock()
+
+		r.recordMetrics()
+		r.setState(r.reportedState(), output)
+		r.persist(output)
+	} else {
+		output := r.handler.Error()
+		log.Printf("%v: %v", r.handler.Name(), err.Error())
+		r.mutex.Lock()
+		r.errOutput = output
+		r.failed = true
+		r.lastError = now
+		r.lastErrorMsg = err.Error()
+		r.errorCount++
+		r.mutex.Unlock()
+
+		r.setState(StateFailed, err.Error())
+	}
+
+	return ok, err
+}
+
+// display returns the routine's output as it should be shown on the statusbar. If the last update failed, then this is
+// the error message, unless the engine is set to keep showing the last good output. Output that is old (as determined
+// by stale) is marked as such.
+func (r *routine) display(stale staleness) string {
+	if r == nil {
+		return ""
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch {
+	case r.failed && stale.keep && r.output != "":
+		return stale.mark(r.colorize(r.output))
+	case r.failed:
+		return r.colorize(r.errOutput)
+	case r.restored:
+		return stale.mark(r.colorize(r.output))
+	case stale.age > 0 && !r.lastSuccess.IsZero() && time.Since(r.lastSuccess) > stale.age:
+		return stale.mark(r.colorize(r.output))
+	}
+
+	return r.colorize(r.output)
+}
+
+// colorize replaces the output's own colors with the routine's colors, if any are set. The caller must hold the
+// routine's mutex.
+func (r *routine) colorize(output string) string {
+	if output == "" || (r.fg == "" && r.bg == "") {
+		return output
+	}
+
+	codes := ""
+	if r.fg != "" {
+		codes += "^c" + r.fg + "^"
+	}
+	if r.bg != "" {
+		codes += "^b" + r.bg + "^"
+	}
+
+	return codes + colorCodes.ReplaceAllString(output, "") + "^d^"
+}
+
+// wait returns a channel that receives when it is time for the routine's next update. start is when the last update
+// began, and err is the error that update returned, if any. If the routine has no more updates scheduled, then the
+// channel is nil so that only the engine can wake the routine up.
+func (r *routine) wait(start time.Time, sched schedule.Schedule, err error) <-chan time.Time {
+	interval := time.Duration(r.interval()) * time.Second
+
+	switch {
+	case err != nil:
+		// If the routine reported an error, then we'll give the process a little time to cool down before trying
+		// again.
+		seconds := interval / time.Second
+		switch {
+		// For routines with intervals up to 1 minute, sleep for 5 seconds.
+		case seconds < 60:
+			interval = 5 * time.Second
+		// For routines with intervals up to 15 minutes, sleep for 1 minute.
+		case seconds < 60*15:
+			interval = 60 * time.Second
+		// For routines with intervals longer than 15 minutes, sleep for 5 minutes.
+		default:
+			interval = 60 * 5 * time.Second
+		}
+	case sched != nil:
+		next := sched.Next(start)
+		if next.IsZero() {
+			return nil
+		}
+		return time.After(time.Until(next))
+	}
+
+	return time.After(interval - time.Since(start))
+}
+
 // setHandler sets the routine's handler.
 func (r *routine) setHandler(handler RoutineHandler) {
 	if r != nil {
@@ -127,6 +324,8 @@ func (r *routine) setHandler(handler RoutineHandler) {
 // interval returns the routine's interval in seconds.
 func (r *routine) interval() int {
 	if r != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
 		return int(r.intervalTime.Seconds())
 	}
 	return 0
@@ -135,13 +334,202 @@ func (r *routine) interval() int {
 // setInterval sets the routine's interval in seconds.
 func (r *routine) setInterval(interval int) {
 	if r != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
 		r.intervalTime = time.Duration(interval) * time.Second
 	}
 }
 
+// getSchedule returns the routine's schedule. If the routine runs on its interval, then this returns nil.
+func (r *routine) getSchedule() schedule.Schedule {
+	if r != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		return r.sched
+	}
+	return nil
+}
+
+// setSchedule sets the routine's schedule. If sched is nil, then the routine runs on its interval.
+func (r *routine) setSchedule(sched schedule.Schedule) {
+	if r != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		r.sched = sched
+	}
+}
+
+// setHistorySize sets up a new history for the routine that holds up to size samples. If the
+// routine's handler does not report any metrics, then this does nothing.
+func (r *routine) setHistorySize(size int) {
+	if r != nil {
+		if _, ok := r.handler.(MetricsReporter); ok {
+			r.history = newHistory(size)
+		}
+	}
+}
+
+// recordMetrics adds the handler's current metrics to the routine's history.
+func (r *routine) recordMetrics() {
+	if r != nil && r.history != nil {
+		if m, ok := r.handler.(MetricsReporter); ok {
+			r.history.add(time.Now(), m.Metrics())
+		}
+	}
+}
+
+// setFeed sets the feed that the routine sends its state changes to.
+func (r *routine) setFeed(f *feed) {
+	if r != nil {
+		r.feed = f
+	}
+}
+
+// setAlerts sets the dispatcher that the routine sends its alerts to.
+func (r *routine) setAlerts(alerts *alert.Dispatcher) {
+	if r != nil {
+		r.alerts = alerts
+	}
+}
+
+// reportedState returns the state that the routine's handler reports for itself. If the handler
+// does not report its state, then this returns StateNormal.
+func (r *routine) reportedState() string {
+	if r != nil {
+		if s, ok := r.handler.(StateReporter); ok {
+			if state := s.State(); state != "" {
+				return state
+			}
+		}
+	}
+	return StateNormal
+}
+
+// setState moves the routine into the provided state. If this is a change from a previous state,
+// then an alert is dispatched with message (stripped of any color codes).
+func (r *routine) setState(state string, message string) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	from := r.state
+	r.state = state
+	r.mutex.Unlock()
+
+	if from == state {
+		return
+	}
+
+	a := alert.Alert{
+		Routine: r.moduleName(),
+		Name:    r.displayName(),
+		From:    from,
+		To:      state,
+		Message: colorCodes.ReplaceAllString(message, ""),
+		Time:    time.Now(),
+	}
+	r.feed.publish(eventState, a)
+
+	// We don't need to send an alert for the first run.
+	if from != "" && r.alerts != nil {
+		r.alerts.Dispatch(a)
+	}
+}
+
+// setStore sets the store that the routine saves its state to. If the routine's handler does not
+// implement Persister, then this does nothing.
+func (r *routine) setStore(store *stateStore) {
+	if r != nil && store != nil {
+		if _, ok := r.handler.(Persister); ok {
+			r.store = store
+		}
+	}
+}
+
+// restore loads the routine's saved state from the store and hands the data back to the handler. The saved output is
+// shown as stale until the routine's next successful update.
+func (r *routine) restore() {
+	if r == nil || r.store == nil {
+		return
+	}
+
+	// If the routine is being restarted, then it already has newer output than what was saved.
+	r.mutex.Lock()
+	hasOutput := r.output != ""
+	r.mutex.Unlock()
+	if hasOutput {
+		return
+	}
+
+	saved, err := r.store.load(r.id)
+	if err != nil {
+		// There won't be anything saved on the first run, so we don't need to log that.
+		if !os.IsNotExist(err) {
+			log.Printf("%v: Failed to load saved state: %v", r.displayName(), err.Error())
+		}
+		return
+	}
+
+	if p, ok := r.handler.(Persister); ok && len(saved.Data) > 0 {
+		if err := p.Restore(saved.Data); err != nil {
+			log.Printf("%v: Failed to restore saved state: %v", r.displayName(), err.Error())
+			return
+		}
+	}
+
+	if saved.Output != "" {
+		r.mutex.Lock()
+		r.output = saved.Output
+		r.restored = true
+		r.lastSuccess = saved.Time
+		r.mutex.Unlock()
+	}
+}
+
+// persist saves the routine's data and output to the store. To keep from writing to the disk too often, this does
+// nothing if the state was saved within the last saveInterval.
+func (r *routine) persist(output string) {
+	if r == nil || r.store == nil || time.Since(r.lastSave) < saveInterval {
+		return
+	}
+
+	p, ok := r.handler.(Persister)
+	if !ok {
+		return
+	}
+
+	data, err := p.Save()
+	if err != nil {
+		log.Printf("%v: Failed to get state: %v", r.displayName(), err.Error())
+		return
+	}
+
+	r.lastSave = time.Now()
+	saved := savedState{Time: r.lastSave, Output: output, Data: data}
+	if err := r.store.save(r.id, saved); err != nil {
+		log.Printf("%v: Failed to save state: %v", r.displayName(), err.Error())
+	}
+}
+
+// results returns the times of the last successful and failed updates, the error from the last failed update, and the
+// number of failed updates since the routine was added.
+func (r *routine) results() (time.Time, time.Time, string, int) {
+	if r == nil {
+		return time.Time{}, time.Time{}, "", 0
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.lastSuccess, r.lastError, r.lastErrorMsg, r.errorCount
+}
+
 // isActive returns whether or not the routine is currently up.
 func (r *routine) isActive() bool {
 	if r != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
 		return r.active
 	}
 	return false
@@ -149,6 +537,8 @@ func (r *routine) isActive() bool {
 
 func (r *routine) setActive(active bool) {
 	if r != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
 		r.active = active
 	}
 }
@@ -157,20 +547,126 @@ func (r *routine) setActive(active bool) {
 // returns 0.
 func (r *routine) uptime() int {
 	if r != nil && r.isActive() {
-		t := time.Since(r.startTime)
-		return int(t.Seconds())
+		return int(time.Since(r.started()).Seconds())
 	}
 	return 0
 }
 
-// displayName returns the routine's display name.
+// displayName returns the routine's display name. This is the name set with setLabel, or the handler's name if no
+// label is set.
 func (r *routine) displayName() string {
 	if r != nil {
+		r.mutex.Lock()
+		label := r.label
+		r.mutex.Unlock()
+		if label != "" {
+			return label
+		}
 		return r.handler.Name()
 	}
 	return "Unknown"
 }
 
+// setLabel sets the display name to use instead of the handler's name. An empty label switches back to the
+// handler's name.
+func (r *routine) setLabel(label string) {
+	if r != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		r.label = label
+	}
+}
+
+// getBar returns the region of the bar that the routine is displayed in.
+func (r *routine) getBar() string {
+	if r != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		return r.bar
+	}
+	return ""
+}
+
+// setBar sets the region of the bar that the routine is displayed in.
+func (r *routine) setBar(bar string) {
+	if r != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		r.bar = bar
+	}
+}
+
+// colors returns the routine's foreground and background colors, if set.
+func (r *routine) colors() (string, string) {
+	if r != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		return r.fg, r.bg
+	}
+	return "", ""
+}
+
+// setColors sets the foreground and background colors to display the routine's output in. Empty colors switch back
+// to the handler's own colors.
+func (r *routine) setColors(fg string, bg string) {
+	if r != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		r.fg = fg
+		r.bg = bg
+	}
+}
+
+// isPaused returns whether or not the routine's scheduled updates are paused.
+func (r *routine) isPaused() bool {
+	if r != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		return r.paused
+	}
+	return false
+}
+
+// setPaused pauses or resumes the routine's scheduled updates. While a routine is paused, it keeps showing its last
+// output, and it only updates when the engine asks it to.
+func (r *routine) setPaused(paused bool) {
+	if r != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		r.paused = paused
+	}
+}
+
+// lastOutput returns the routine's last good output and its last error message.
+func (r *routine) lastOutput() (string, string) {
+	if r != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		return r.output, r.lastErrorMsg
+	}
+	return "", ""
+}
+
+// currentState returns the routine's current state.
+func (r *routine) currentState() string {
+	if r != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		return r.state
+	}
+	return ""
+}
+
+// started returns the time the routine was last started.
+func (r *routine) started() time.Time {
+	if r != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		return r.startTime
+	}
+	return time.Time{}
+}
+
 // moduleName returns the routine's module name.
 func (r *routine) moduleName() string {
 	if r != nil {
@@ -197,6 +693,28 @@ func (r *routine) update() {
 	}
 }
 
+// waitStopped blocks until the routine's run loop exits or timeout seconds pass. It returns true if the loop exited (or
+// was never started), otherwise false.
+func (r *routine) waitStopped(timeout int) bool {
+	if r == nil {
+		return true
+	}
+
+	r.mutex.Lock()
+	done := r.done
+	r.mutex.Unlock()
+	if done == nil {
+		return true
+	}
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(time.Duration(timeout) * time.Second):
+		return false
+	}
+}
+
 // stop attempts to stop the routine by sending on the stop channel. It blocks on sending no longer than timeout
 // seconds. stop returns true if the send is successful, otherwise false.
 func (r *routine) stop(timeout int) bool {
@@ -5,12 +5,23 @@ package sbbattery
 import (
 	"fmt"
 	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var colorEnd = "^d^"
 
+// powerSupplyDir is the directory that the kernel lists power supplies in.
+var powerSupplyDir = "/sys/class/power_supply"
+
+// windowSize is the number of readings used to estimate the rate of charge or discharge when the
+// batteries don't report it themselves.
+const windowSize = 10
+
 // These are the possible charging states of the battery.
 const (
 	statusUnknown  = 0
@@ -19,20 +30,80 @@ const (
 	statusFull
 )
 
+// These are the names of the files that hold a battery's charge thresholds. Newer kernels use the
+// first pair, and some older drivers use the second.
+var thresholdFiles = [][2]string{
+	{"charge_control_start_threshold", "charge_control_end_threshold"},
+	{"charge_start_threshold", "charge_stop_threshold"},
+}
+
+// These are the kinds of readings that a battery can report its capacity in.
+const (
+	unitEnergy   = "energy"   // µWh, from energy_now and energy_full
+	unitCharge   = "charge"   // µAh, from charge_now and charge_full
+	unitCapacity = "capacity" // Percentage, from capacity
+)
+
 // Routine is the main type for this package.
 type Routine struct {
 	// Error encountered along the way, if any.
 	err error
 
-	// Maximum capacity of battery.
-	max int
+	// Batteries found during the last update, sorted by name.
+	batteries []battery
 
-	// Percentage of battery capacity left.
+	// Percentage of capacity left across all batteries.
 	perc int
 
-	// Status of the battery (unknown, charging, discharging, or full).
+	// Status of the batteries as a whole (unknown, charging, discharging, or full).
 	status int
 
+	// Rate that the batteries are charging or discharging, in µW if the batteries' energy is known
+	// or in percent per hour if it isn't. This is 0 if the rate is not known.
+	rate float64
+
+	// Whether or not rate is in µW.
+	watts bool
+
+	// Estimated time until the batteries are empty (while discharging) or full (while charging), or
+	// 0 if it is not known.
+	left time.Duration
+
+	// Recent readings of the batteries' combined level, for estimating the rate when the batteries
+	// don't report it themselves.
+	window []reading
+
+	// Whether or not an AC adapter is online, and whether or not any AC adapters were found at all.
+	ac      bool
+	acFound bool
+
+	// Health of the batteries as a whole, as a percentage of their design capacity, or -1 if it is
+	// not known.
+	health int
+
+	// Charge thresholds to apply to the batteries, as set with SetThresholds. These are 0 if they
+	// haven't been set.
+	start int
+	end   int
+
+	// Whether or not every battery has the requested charge thresholds.
+	applied bool
+
+	// Whether or not to show each battery separately, as set with ShowEach.
+	each bool
+
+	// Whether or not to show the time left, as set with ShowTime.
+	showTime bool
+
+	// Whether or not to show the current wattage, as set with ShowPower.
+	showPower bool
+
+	// Whether or not to show the AC adapter's state, as set with ShowAC.
+	showAC bool
+
+	// Whether or not to show the batteries' health, as set with ShowHealth.
+	showHealth bool
+
 	// The three user-provided colors for displaying the various states.
 	colors struct {
 		normal  string
@@ -41,11 +112,55 @@ type Routine struct {
 	}
 }
 
-// New reads the maximum capacity of the battery and returns a Routine object. colors is an optional
-// triplet of hex color codes for colorizing the output based on these rules:
-//   1. Normal color, battery has more than 25% left.
-//   2. Warning color, battery has between 10% and 25% left.
-//   3. Error color, battery has less than 10% left.
+// battery holds the readings of a single battery.
+type battery struct {
+	// Name of the battery, e.g. "BAT0".
+	name string
+
+	// Kind of readings that the battery reports.
+	unit string
+
+	// Current and full capacity of the battery, in the battery's unit.
+	now  int
+	full int
+
+	// Percentage of capacity left.
+	perc int
+
+	// Status of the battery (unknown, charging, discharging, or full).
+	status int
+
+	// Current and full energy of the battery in µWh, or -1 if it can't be determined.
+	energyNow  float64
+	energyFull float64
+
+	// Power that the battery is charging or discharging at in µW, or -1 if it isn't reported.
+	power float64
+
+	// Health of the battery, as a percentage of its design capacity, or -1 if it isn't reported.
+	health int
+
+	// Charge start and end thresholds, as percentages, or -1 if the battery doesn't have them.
+	start int
+	end   int
+
+	// Files that hold the thresholds, or empty if the battery doesn't have them.
+	startFile string
+	endFile   string
+}
+
+// reading is a single reading of the batteries' combined level.
+type reading struct {
+	time  time.Time
+	level float64
+}
+
+// New makes a new Routine object. The batteries are found when the routine updates, so batteries
+// that are added later (or that can't be read at first) are picked up as well. colors is an
+// optional triplet of hex color codes for colorizing the output based on these rules:
+//   1. Normal color, batteries have more than 25% left.
+//   2. Warning color, batteries have between 10% and 25% left.
+//   3. Error color, batteries have less than 10% left.
 func New(colors ...[3]string) *Routine {
 	var r Routine
 
@@ -59,59 +174,178 @@ func New(colors ...[3]string) *Routine {
 		colorEnd = ""
 	}
 
-	// Error will be handled in both Update() and String().
-	r.max, r.err = readCharge("/sys/class/power_supply/BAT0/charge_full")
-
 	return &r
 }
 
-// Update reads the current battery capacity left and calculates a percentage based on it.
-func (r *Routine) Update() (bool, error) {
+// ShowEach shows the percentage and status of each battery separately (e.g. "+85%/-40% BAT")
+// instead of the combined percentage of all of them.
+func (r *Routine) ShowEach(enable bool) {
+	if r != nil {
+		r.each = enable
+	}
+}
+
+// ShowTime shows the estimated time until the batteries are empty (while discharging) or full
+// (while charging), e.g. "-85% BAT 2:15".
+func (r *Routine) ShowTime(enable bool) {
+	if r != nil {
+		r.showTime = enable
+	}
+}
+
+// ShowPower shows the wattage that the batteries are charging or discharging at, e.g.
+// "-85% BAT 11.2W". This is only shown if the batteries report their energy.
+func (r *Routine) ShowPower(enable bool) {
+	if r != nil {
+		r.showPower = enable
+	}
+}
+
+// ShowAC shows "AC" after the percentage while an AC adapter is online, e.g. "85% BAT AC".
+func (r *Routine) ShowAC(enable bool) {
+	if r != nil {
+		r.showAC = enable
+	}
+}
+
+// ShowHealth shows the health of the batteries, which is how much they can hold now as a percentage
+// of how much they could hold when new, e.g. "-85% BAT H:92%".
+func (r *Routine) ShowHealth(enable bool) {
+	if r != nil {
+		r.showHealth = enable
+	}
+}
+
+// SetThresholds sets the charge thresholds for the batteries, as percentages. Batteries start
+// charging when they drop below start and stop charging at end, which helps them last longer. The
+// routine applies the thresholds on every update where the battery allows it (this usually requires
+// permission to write to the battery's files in /sys/class/power_supply). If any battery doesn't
+// have these thresholds, then "!TH" is shown after the percentage, e.g. "85% BAT !TH".
+func (r *Routine) SetThresholds(start int, end int) error {
 	if r == nil {
-		return false, fmt.Errorf("bad routine")
+		return fmt.Errorf("bad routine")
+	}
+
+	if start < 0 || end > 100 || start >= end {
+		return fmt.Errorf("invalid thresholds")
 	}
 
-	// Handle error in New or error reading max capacity.
-	if r.max <= 0 {
-		return false, r.err
+	r.start = start
+	r.end = end
+	return nil
+}
+
+// Update finds all of the batteries and reads their current capacity, then calculates the
+// percentage left across all of them.
+func (r *Routine) Update() (bool, error) {
+	if r == nil {
+		return false, fmt.Errorf("bad routine")
 	}
 
-	// Get current charge and calculate a percentage.
-	now, err := readCharge("/sys/class/power_supply/BAT0/charge_now")
+	batteries, adapters, err := findSupplies()
 	if err != nil {
-		r.err = fmt.Errorf("error reading charge")
+		r.err = fmt.Errorf("error finding batteries")
 		return true, err
 	}
+	if len(batteries) == 0 {
+		// Keep trying, in case a battery is plugged in later.
+		r.err = fmt.Errorf("no battery found")
+		return true, r.err
+	}
 
-	r.perc = (now * 100) / r.max
-	switch {
-	case r.perc < 0:
-		r.perc = 0
-	case r.perc > 100:
-		r.perc = 100
+	for i := range batteries {
+		if err := batteries[i].read(); err != nil {
+			r.err = fmt.Errorf("error reading %s", batteries[i].name)
+			return true, err
+		}
 	}
 
-	// Get charging status.
-	status, err := ioutil.ReadFile("/sys/class/power_supply/BAT0/status")
-	if err != nil {
-		r.err = fmt.Errorf("error reading status")
-		return true, err
+	r.acFound = len(adapters) > 0
+	r.ac = false
+	for _, adapter := range adapters {
+		if readString(filepath.Join(powerSupplyDir, adapter, "online")) == "1" {
+			r.ac = true
+		}
 	}
 
-	switch strings.TrimSpace(string(status)) {
-	case "Charging":
-		r.status = statusCharging
-	case "Discharging":
-		r.status = statusDischarging
-	case "Full":
-		r.status = statusFull
-	default:
-		r.status = statusUnknown
+	r.applied = true
+	if r.end > 0 {
+		for i := range batteries {
+			if !batteries[i].applyThresholds(r.start, r.end) {
+				r.applied = false
+			}
+		}
+	}
+
+	status := combinedStatus(batteries)
+	if status != r.status || len(batteries) != len(r.batteries) {
+		// The old readings don't say anything about the new rate.
+		r.window = r.window[:0]
 	}
 
+	r.batteries = batteries
+	r.perc = combinedPerc(batteries)
+	r.status = status
+	r.health = combinedHealth(batteries)
+	r.estimate(time.Now())
+
 	return true, nil
 }
 
+// estimate calculates the rate that the batteries are charging or discharging at and how long until
+// they are empty or full. The rate reported by the batteries is used if every battery reports it.
+// Otherwise, the rate is estimated from the change in level over the last several readings.
+func (r *Routine) estimate(now time.Time) {
+	level, full, power := 0.0, 0.0, 0.0
+	r.watts = true
+	for _, b := range r.batteries {
+		if b.energyNow < 0 || b.energyFull < 0 {
+			r.watts = false
+		}
+		if b.power < 0 {
+			power = -1
+		} else if power >= 0 {
+			power += b.power
+		}
+		level += b.energyNow
+		full += b.energyFull
+	}
+
+	if !r.watts {
+		// Fall back to the percentage.
+		level, full, power = float64(r.perc), 100, -1
+	}
+
+	r.window = append(r.window, reading{now, level})
+	if len(r.window) > windowSize {
+		r.window = r.window[len(r.window)-windowSize:]
+	}
+
+	r.rate = 0
+	if power > 0 {
+		r.rate = power
+	} else if len(r.window) > 1 {
+		first, last := r.window[0], r.window[len(r.window)-1]
+		if hours := last.time.Sub(first.time).Hours(); hours > 0 {
+			r.rate = math.Abs(last.level-first.level) / hours
+		}
+	}
+
+	r.left = 0
+	if r.rate > 0 {
+		var hours float64
+		switch r.status {
+		case statusDischarging:
+			hours = level / r.rate
+		case statusCharging:
+			hours = (full - level) / r.rate
+		}
+		if hours > 0 {
+			r.left = time.Duration(hours * float64(time.Hour))
+		}
+	}
+}
+
 // String formats the percentage of battery left.
 func (r *Routine) String() string {
 	if r == nil {
@@ -119,24 +353,43 @@ func (r *Routine) String() string {
 	}
 
 	var c string
-	if r.perc > 25 {
+	switch r.State() {
+	case "normal":
 		c = r.colors.normal
-	} else if r.perc > 10 {
+	case "warning":
 		c = r.colors.warning
-	} else {
+	default:
 		c = r.colors.error
 	}
 
-	s := fmt.Sprintf("%v%%", r.perc)
-	if r.status == statusCharging {
-		s = "+" + s
-	} else if r.status == statusDischarging {
-		s = "-" + s
-	} else if r.status == statusFull {
-		s = "Full"
+	s := formatPerc(r.perc, r.status)
+	if r.each && len(r.batteries) > 1 {
+		parts := make([]string, len(r.batteries))
+		for i, b := range r.batteries {
+			parts[i] = formatPerc(b.perc, b.status)
+		}
+		s = strings.Join(parts, "/")
+	}
+
+	s += " BAT"
+	if r.showTime && r.left > 0 {
+		minutes := int(r.left.Minutes())
+		s += fmt.Sprintf(" %d:%02d", minutes/60, minutes%60)
+	}
+	if r.showPower && r.watts && r.rate > 0 {
+		s += fmt.Sprintf(" %.1fW", r.rate/1e6)
+	}
+	if r.showAC && r.ac {
+		s += " AC"
+	}
+	if r.showHealth && r.health >= 0 {
+		s += fmt.Sprintf(" H:%v%%", r.health)
+	}
+	if !r.applied {
+		s += " !TH"
 	}
 
-	return fmt.Sprintf("%s%s BAT%s", c, s, colorEnd)
+	return c + s + colorEnd
 }
 
 // Error formats and returns an error message.
@@ -157,8 +410,317 @@ func (r *Routine) Name() string {
 	return "Battery"
 }
 
-// readCharge reads out the value from the file at the provided path.
-func readCharge(path string) (int, error) {
+// State returns "normal", "warning", or "error" depending on how much battery capacity is left,
+// following the same rules used for colorizing the output.
+func (r *Routine) State() string {
+	if r == nil {
+		return "error"
+	}
+
+	switch {
+	case r.perc > 25:
+		return "normal"
+	case r.perc > 10:
+		return "warning"
+	}
+
+	return "error"
+}
+
+// Metrics returns the percentage of capacity left. If they are known, it also returns the wattage
+// that the batteries are charging or discharging at, the number of seconds until they are empty or
+// full, whether or not an AC adapter is online (1 or 0), the batteries' health, the charge
+// thresholds that the first battery with thresholds currently has, and whether or not the charge
+// thresholds set with SetThresholds are applied (1 or 0).
+func (r *Routine) Metrics() map[string]float64 {
+	if r == nil {
+		return nil
+	}
+
+	m := map[string]float64{"percent": float64(r.perc)}
+	if r.watts && r.rate > 0 {
+		m["watts"] = r.rate / 1e6
+	}
+	if r.left > 0 {
+		switch r.status {
+		case statusDischarging:
+			m["time_to_empty"] = r.left.Seconds()
+		case statusCharging:
+			m["time_to_full"] = r.left.Seconds()
+		}
+	}
+	if r.acFound {
+		m["ac_online"] = boolMetric(r.ac)
+	}
+	if r.health >= 0 {
+		m["health"] = float64(r.health)
+	}
+	for _, b := range r.batteries {
+		if b.end < 0 {
+			continue
+		}
+		if b.start >= 0 {
+			m["charge_start_threshold"] = float64(b.start)
+		}
+		m["charge_end_threshold"] = float64(b.end)
+		break
+	}
+	if r.end > 0 {
+		m["thresholds_applied"] = boolMetric(r.applied)
+	}
+
+	return m
+}
+
+// findSupplies finds every system battery and AC adapter in the power supply directory. Batteries
+// that belong to devices, like wireless mice, are skipped.
+func findSupplies() ([]battery, []string, error) {
+	entries, err := ioutil.ReadDir(powerSupplyDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	batteries := make([]battery, 0)
+	adapters := make([]string, 0)
+	for _, entry := range entries {
+		dir := filepath.Join(powerSupplyDir, entry.Name())
+		switch readString(filepath.Join(dir, "type")) {
+		case "Battery":
+			if readString(filepath.Join(dir, "scope")) == "Device" {
+				continue
+			}
+			batteries = append(batteries, battery{name: entry.Name()})
+		case "Mains":
+			adapters = append(adapters, entry.Name())
+		}
+	}
+
+	sort.Slice(batteries, func(i, j int) bool {
+		return batteries[i].name < batteries[j].name
+	})
+
+	return batteries, adapters, nil
+}
+
+// read reads the battery's current capacity and status. Batteries can report their capacity as
+// energy or charge, or only as a percentage.
+func (b *battery) read() error {
+	dir := filepath.Join(powerSupplyDir, b.name)
+
+	var err error
+	for _, unit := range []string{unitEnergy, unitCharge} {
+		if b.full, err = readInt(filepath.Join(dir, unit+"_full")); err != nil {
+			continue
+		}
+		if b.now, err = readInt(filepath.Join(dir, unit+"_now")); err != nil {
+			return err
+		}
+		b.unit = unit
+		break
+	}
+
+	if b.unit == "" {
+		// Fall back to the percentage that the kernel calculates.
+		if b.now, err = readInt(filepath.Join(dir, "capacity")); err != nil {
+			return err
+		}
+		b.full = 100
+		b.unit = unitCapacity
+	}
+
+	b.health = -1
+	if b.unit != unitCapacity {
+		if design, err := readInt(filepath.Join(dir, b.unit+"_full_design")); err == nil && design > 0 {
+			b.health = (b.full * 100) / design
+		}
+	}
+
+	b.start, b.end = -1, -1
+	for _, files := range thresholdFiles {
+		if end, err := readInt(filepath.Join(dir, files[1])); err == nil {
+			b.end = end
+			b.endFile = filepath.Join(dir, files[1])
+			if start, err := readInt(filepath.Join(dir, files[0])); err == nil {
+				b.start = start
+				b.startFile = filepath.Join(dir, files[0])
+			}
+			break
+		}
+	}
+
+	b.perc = perc(b.now, b.full)
+	b.status = parseStatus(readString(filepath.Join(dir, "status")))
+
+	// Work out the energy and power in µWh and µW. Batteries that report charge need the voltage to
+	// convert it. Some drivers report negative values while discharging.
+	voltage, err := readInt(filepath.Join(dir, "voltage_now"))
+	if err != nil {
+		voltage = -1
+	}
+	b.energyNow, b.energyFull, b.power = -1, -1, -1
+	switch b.unit {
+	case unitEnergy:
+		b.energyNow, b.energyFull = float64(b.now), float64(b.full)
+		if power, err := readInt(filepath.Join(dir, "power_now")); err == nil {
+			b.power = math.Abs(float64(power))
+		}
+	case unitCharge:
+		if voltage > 0 {
+			b.energyNow = float64(b.now) * float64(voltage) / 1e6
+			b.energyFull = float64(b.full) * float64(voltage) / 1e6
+			if current, err := readInt(filepath.Join(dir, "current_now")); err == nil {
+				b.power = math.Abs(float64(current)) * float64(voltage) / 1e6
+			}
+		}
+	}
+
+	return nil
+}
+
+// combinedPerc calculates the percentage of capacity left across all of the batteries. If the
+// batteries all report their capacity the same way, then the percentage is weighted by each
+// battery's size. Otherwise, it is the average of their percentages.
+func combinedPerc(batteries []battery) int {
+	now, full, sum := 0, 0, 0
+	for _, b := range batteries {
+		if b.unit != batteries[0].unit {
+			now = -1
+		}
+		if now >= 0 {
+			now += b.now
+			full += b.full
+		}
+		sum += b.perc
+	}
+
+	if now < 0 {
+		return sum / len(batteries)
+	}
+
+	return perc(now, full)
+}
+
+// combinedHealth calculates the average health of the batteries that report it, or -1 if none of
+// them do.
+func combinedHealth(batteries []battery) int {
+	sum, n := 0, 0
+	for _, b := range batteries {
+		if b.health >= 0 {
+			sum += b.health
+			n++
+		}
+	}
+
+	if n == 0 {
+		return -1
+	}
+
+	return sum / n
+}
+
+// applyThresholds tries to set the battery's charge thresholds if they aren't already set, and
+// reports whether or not the battery has them afterward. The start threshold is only checked if the
+// battery has one, since some batteries only support an end threshold.
+func (b *battery) applyThresholds(start int, end int) bool {
+	if b.endFile == "" {
+		return false
+	}
+
+	writeStart := func() {
+		if b.startFile != "" && b.start != start {
+			if writeInt(b.startFile, start) == nil {
+				b.start = start
+			}
+		}
+	}
+	writeEnd := func() {
+		if b.end != end {
+			if writeInt(b.endFile, end) == nil {
+				b.end = end
+			}
+		}
+	}
+
+	// The kernel rejects a start threshold above the current end threshold (and the reverse), so
+	// write them in whichever order keeps them valid.
+	if start > b.end {
+		writeEnd()
+		writeStart()
+	} else {
+		writeStart()
+		writeEnd()
+	}
+
+	return b.end == end && (b.startFile == "" || b.start == start)
+}
+
+// combinedStatus determines the status of the batteries as a whole. They are charging if any of
+// them are charging, discharging if any of them are discharging, and full if all of them are full.
+func combinedStatus(batteries []battery) int {
+	status := statusFull
+	for _, b := range batteries {
+		switch b.status {
+		case statusCharging:
+			return statusCharging
+		case statusDischarging:
+			status = statusDischarging
+		case statusUnknown:
+			if status == statusFull {
+				status = statusUnknown
+			}
+		}
+	}
+
+	return status
+}
+
+// formatPerc formats the percentage with an indicator for the status.
+func formatPerc(perc int, status int) string {
+	switch status {
+	case statusCharging:
+		return fmt.Sprintf("+%v%%", perc)
+	case statusDischarging:
+		return fmt.Sprintf("-%v%%", perc)
+	case statusFull:
+		return "Full"
+	}
+
+	return fmt.Sprintf("%v%%", perc)
+}
+
+// perc calculates the percentage that now is of full, between 0 and 100.
+func perc(now int, full int) int {
+	if full <= 0 {
+		return 0
+	}
+
+	p := (now * 100) / full
+	switch {
+	case p < 0:
+		p = 0
+	case p > 100:
+		p = 100
+	}
+
+	return p
+}
+
+// parseStatus converts the contents of a battery's status file into its status.
+func parseStatus(status string) int {
+	switch status {
+	case "Charging":
+		return statusCharging
+	case "Discharging":
+		return statusDischarging
+	case "Full":
+		return statusFull
+	}
+
+	return statusUnknown
+}
+
+// readInt reads out the value from the file at the provided path.
+func readInt(path string) (int, error) {
 	b, err := ioutil.ReadFile(path)
 	if err != nil {
 		return -1, err
@@ -166,3 +728,28 @@ func readCharge(path string) (int, error) {
 
 	return strconv.Atoi(strings.TrimSpace(string(b)))
 }
+
+// writeInt writes the value to the file at the provided path.
+func writeInt(path string, value int) error {
+	return ioutil.WriteFile(path, []byte(strconv.Itoa(value)), 0o644)
+}
+
+// boolMetric converts a boolean into a metric value.
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// readString reads out the contents of the file at the provided path, or an empty string if it
+// can't be read.
+func readString(path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(b))
+}
@@ -1,4 +1,4 @@
-// Package sbcputemp displays the temperature of the CPU in degrees Celsius.
+// Package sbcputemp displays the temperature of the CPU in degrees Celsius, Fahrenheit, or both.
 // Currently only supported on Linux.
 package sbcputemp
 
@@ -6,26 +6,69 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 var colorEnd = "^d^"
 
-// We need to root around in this directory for the device directory for the fan.
-const baseDir = "/sys/class/hwmon/"
+// These are the directories that the kernel lists temperature sensors in. The thermal zones are
+// only used if none of the hardware monitors have a sensor that we want.
+var (
+	hwmonDir   = "/sys/class/hwmon"
+	thermalDir = "/sys/class/thermal"
+)
+
+// cpuChips are the names of the hardware monitors that measure the CPU's temperature, in order of
+// preference. acpitz is the ACPI thermal zone, which is usually near the CPU but not in it.
+var cpuChips = []string{"coretemp", "k10temp", "zenpower", "cpu_thermal", "acpitz"}
+
+// These are the units for displaying the temperature, set with SetUnit.
+const (
+	// Celsius shows the temperature in degrees Celsius, e.g. "50 °C". This is the default.
+	Celsius = iota
+
+	// Fahrenheit shows the temperature in degrees Fahrenheit, e.g. "122 °F".
+	Fahrenheit
+
+	// Both shows the temperature in degrees Celsius and Fahrenheit, e.g. "50 °C/122 °F".
+	Both
+)
+
+// These are the temperatures, in degrees Celsius, that the colors change at if the sensors don't
+// report their own thresholds.
+const (
+	defaultWarning = 75
+	defaultError   = 100
+)
 
 // Routine is the main object for this package.
 type Routine struct {
 	// Error encountered along the way, if any.
 	err error
 
-	// Slice of files that contain temperature readings.
-	files []string
+	// Sensors that we read the temperature from.
+	sensors []sensor
+
+	// Sensors to use, as set with SetSensors. If this is empty, then the CPU's sensors are found
+	// automatically.
+	names []string
+
+	// Whether or not to show the hottest sensor instead of the average, as set with UseMax.
+	max bool
 
-	// Average temperature across all sensors, in degrees Celsius.
+	// Average (or hottest) temperature across all sensors, in milliCelsius.
 	temp int
 
+	// Temperatures that the warning and error colors start at, in milliCelsius, as set with
+	// SetThresholds. These are 0 if they should come from the sensors.
+	warning int
+	error   int
+
+	// Unit to display the temperature in, as set with SetUnit.
+	unit int
+
 	// Trio of user-provided colors for displaying various states.
 	colors struct {
 		normal  string
@@ -34,12 +77,33 @@ type Routine struct {
 	}
 }
 
-// New finds the device directory, builds a list of all the temperature sensors in it, and makes a
-// new object. colors is an optional triplet of hex color codes for colorizing the output based on
-// these rules:
-//   1. Normal color, CPU temperature is cooler than 75 °C.
-//   2. Warning color, CPU temperature is between 75 °C and 100 °C.
-//   3. Error color, CPU temperature is hotter than 100 °C.
+// sensor is a single temperature sensor.
+type sensor struct {
+	// Name of the hardware monitor (e.g. "coretemp" or "nvme") or type of the thermal zone (e.g.
+	// "x86_pkg_temp") that the sensor belongs to.
+	chip string
+
+	// Label of the sensor (e.g. "Package id 0" or "Tctl"). Sensors without a label are named after
+	// their file (e.g. "temp1") or thermal zone (e.g. "thermal_zone0").
+	label string
+
+	// File that holds the sensor's reading, in milliCelsius.
+	input string
+
+	// Highest temperature that the sensor should reach during normal operation and temperature at
+	// which the hardware is in danger, in milliCelsius. These are 0 if the sensor doesn't report
+	// them.
+	max  int
+	crit int
+}
+
+// New makes a new object. The temperature sensors are found during the first update. colors is an
+// optional triplet of hex color codes for colorizing the output based on these rules:
+//   1. Normal color, CPU temperature is cooler than the sensors' max temperature.
+//   2. Warning color, CPU temperature is between the sensors' max and critical temperatures.
+//   3. Error color, CPU temperature is at or above the sensors' critical temperature.
+// If the sensors don't report a max or critical temperature, then 75 °C and 100 °C are used. The
+// thresholds can be overridden with SetThresholds.
 func New(colors ...[3]string) *Routine {
 	var r Routine
 
@@ -53,40 +117,83 @@ func New(colors ...[3]string) *Routine {
 		colorEnd = ""
 	}
 
-	path, err := findDir()
-	if err != nil {
-		r.err = err
-		return &r
+	return &r
+}
+
+// SetSensors chooses which sensors to read the temperature from, instead of finding the CPU's
+// sensors automatically. Each name is either the name of a hardware monitor in /sys/class/hwmon
+// (e.g. "coretemp", "k10temp", or "nvme") to use all of its sensors, or a hardware monitor and a
+// sensor label separated by a colon (e.g. "coretemp:Package id 0" or "k10temp:Tctl") to use only
+// that sensor. Names that don't match any hardware monitor are matched against the types of the
+// thermal zones in /sys/class/thermal (e.g. "x86_pkg_temp"). Names are not case-sensitive.
+func (r *Routine) SetSensors(names ...string) {
+	if r != nil {
+		r.names = names
+		r.sensors = nil
 	}
+}
 
-	files, err := findFiles(path)
-	if err != nil {
-		r.err = err
-		return &r
+// UseMax shows the temperature of the hottest sensor instead of the average of all of them.
+func (r *Routine) UseMax(enable bool) {
+	if r != nil {
+		r.max = enable
 	}
+}
 
-	r.files = files
-	return &r
+// SetThresholds sets the temperatures, in degrees Celsius, that the warning and error colors start
+// at, instead of using the sensors' max and critical temperatures. A threshold of 0 keeps using the
+// sensors' value for that color.
+func (r *Routine) SetThresholds(warning int, critical int) error {
+	if r == nil {
+		return fmt.Errorf("bad routine")
+	}
+
+	if warning < 0 || critical < 0 || (warning > 0 && critical > 0 && warning > critical) {
+		return fmt.Errorf("invalid thresholds")
+	}
+
+	r.warning = warning * 1000
+	r.error = critical * 1000
+	return nil
 }
 
-// Update reads out the value of each sensor, gets an average of all temperatures, and converts it
-// from milliCelsius to Celsius. If we have trouble reading a particular sensor, then we'll skip it
-// on this pass.
+// SetUnit sets the unit to display the temperature in. unit is one of Celsius, Fahrenheit, or Both.
+func (r *Routine) SetUnit(unit int) error {
+	if r == nil {
+		return fmt.Errorf("bad routine")
+	}
+
+	if unit < Celsius || unit > Both {
+		return fmt.Errorf("invalid unit")
+	}
+
+	r.unit = unit
+	return nil
+}
+
+// Update reads out the value of each sensor and gets an average (or the hottest) of all
+// temperatures. If we have trouble reading a particular sensor, then we'll skip it on this pass.
 func (r *Routine) Update() (bool, error) {
 	if r == nil {
 		return false, fmt.Errorf("bad routine")
 	}
 
-	// Handle error in New.
-	if len(r.files) == 0 {
-		return false, r.err
+	if len(r.sensors) == 0 {
+		// The sensors' driver might not be loaded yet, so we'll keep looking on later updates.
+		sensors, err := r.findSensors()
+		if err != nil {
+			r.err = err
+			return true, err
+		}
+		r.sensors = sensors
 	}
 
-	r.temp = 0
+	sum := 0
+	max := 0
 	numRead := 0
-	for _, file := range r.files {
-		// If we can't read a sensor's value, then we won't include it in the average.
-		b, err := ioutil.ReadFile(file)
+	for _, sensor := range r.sensors {
+		// If we can't read a sensor's value, then we won't include it.
+		b, err := ioutil.ReadFile(sensor.input)
 		if err != nil {
 			continue
 		}
@@ -96,35 +203,58 @@ func (r *Routine) Update() (bool, error) {
 			continue
 		}
 
-		r.temp += n
+		sum += n
+		if numRead == 0 || n > max {
+			max = n
+		}
 		numRead++
 	}
 
-	// Get the average temp across all readings.
-	r.temp /= numRead
+	if numRead == 0 {
+		r.err = fmt.Errorf("no readings")
+		return true, r.err
+	}
 
-	// Convert from milliCelsius to Celsius.
-	r.temp /= 1000
+	// Get the average temp across all readings, or the hottest one.
+	if r.max {
+		r.temp = max
+	} else {
+		r.temp = sum / numRead
+	}
 
 	return true, nil
 }
 
-// String prints a formatted temperature average in degrees Celsius.
+// String prints a formatted temperature in degrees Celsius, Fahrenheit, or both.
 func (r *Routine) String() string {
 	if r == nil {
 		return "bad routine"
 	}
 
 	var c string
-	if r.temp < 75 {
+	warning, critical := r.thresholds()
+	if r.temp < warning {
 		c = r.colors.normal
-	} else if r.temp < 100 {
+	} else if r.temp < critical {
 		c = r.colors.warning
 	} else {
 		c = r.colors.error
 	}
 
-	return fmt.Sprintf("%s%v °C%s", c, r.temp, colorEnd)
+	celsius := fmt.Sprintf("%v °C", r.temp/1000)
+	fahrenheit := fmt.Sprintf("%v °F", (r.temp*9/5+32000)/1000)
+
+	var s string
+	switch r.unit {
+	case Fahrenheit:
+		s = fahrenheit
+	case Both:
+		s = celsius + "/" + fahrenheit
+	default:
+		s = celsius
+	}
+
+	return c + s + colorEnd
 }
 
 // Error formats and returns an error message.
@@ -145,58 +275,213 @@ func (r *Routine) Name() string {
 	return "CPU Temp"
 }
 
-// findDir finds the directory that has the temperature readings. It will be the one with the fan
-// speeds, somewhere in /sys/class/hwmon.
-func findDir() (string, error) {
-	// Get all the device directories in the main directory.
-	dirs, err := ioutil.ReadDir(baseDir)
-	if err != nil {
-		return "", err
+// thresholds returns the temperatures that the warning and error colors start at, in milliCelsius.
+// These are the ones set with SetThresholds if there are any, or else the lowest max and critical
+// temperatures of the sensors, or else the defaults.
+func (r *Routine) thresholds() (int, int) {
+	warning, critical := r.warning, r.error
+	for _, sensor := range r.sensors {
+		if r.warning == 0 && sensor.max > 0 && (warning == 0 || sensor.max < warning) {
+			warning = sensor.max
+		}
+		if r.error == 0 && sensor.crit > 0 && (critical == 0 || sensor.crit < critical) {
+			critical = sensor.crit
+		}
+	}
+
+	if critical == 0 {
+		critical = defaultError * 1000
+	}
+	if warning == 0 {
+		warning = defaultWarning * 1000
+		if warning > critical {
+			warning = critical
+		}
 	}
 
-	// Search in each device directory to find the fan.
+	return warning, critical
+}
+
+// findSensors finds the sensors to read the temperature from. If sensors were chosen with
+// SetSensors, then those are used. Otherwise, this uses the sensors of the first CPU hardware
+// monitor in cpuChips, falling back to the thermal zones if there aren't any.
+func (r *Routine) findSensors() ([]sensor, error) {
+	hwmon := hwmonSensors()
+	zones := thermalSensors()
+
+	var found []sensor
+	if len(r.names) > 0 {
+		for _, name := range r.names {
+			matches := matchSensors(hwmon, name)
+			if len(matches) == 0 {
+				matches = matchSensors(zones, name)
+			}
+			found = append(found, matches...)
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("no matching sensors")
+		}
+		return found, nil
+	}
+
+	for _, chip := range cpuChips {
+		if found = matchSensors(hwmon, chip); len(found) > 0 {
+			return found, nil
+		}
+	}
+
+	// Fall back to the thermal zones, preferring the CPU package's zone if there is one.
+	if found = matchSensors(zones, "x86_pkg_temp"); len(found) > 0 {
+		return found, nil
+	}
+	if len(zones) > 0 {
+		return zones, nil
+	}
+
+	return nil, fmt.Errorf("no temperature sensors")
+}
+
+// hwmonSensors finds every temperature sensor of every hardware monitor. Older kernels keep the
+// sensors in the monitor's device directory instead of the monitor's own directory.
+func hwmonSensors() []sensor {
+	dirs, _ := filepath.Glob(filepath.Join(hwmonDir, "hwmon*"))
+	sortNumeric(dirs)
+
+	var sensors []sensor
 	for _, dir := range dirs {
-		path := baseDir + dir.Name() + "/device/"
-		files, err := ioutil.ReadDir(path)
-		if err != nil {
-			return "", err
+		chip := readString(filepath.Join(dir, "name"))
+		if chip == "" {
+			chip = readString(filepath.Join(dir, "device", "name"))
 		}
 
-		// If we encounter a file that matches "fan.*output", then we have the right directory.
-		for _, file := range files {
-			if strings.HasPrefix(file.Name(), "fan") && strings.HasSuffix(file.Name(), "output") {
-				// We found our directory. Return the path.
-				return path, nil
+		inputs, _ := filepath.Glob(filepath.Join(dir, "temp*_input"))
+		if len(inputs) == 0 {
+			inputs, _ = filepath.Glob(filepath.Join(dir, "device", "temp*_input"))
+		}
+		sortNumeric(inputs)
+
+		for _, input := range inputs {
+			prefix := strings.TrimSuffix(input, "_input")
+			label := readString(prefix + "_label")
+			if label == "" {
+				label = filepath.Base(prefix)
 			}
+			sensors = append(sensors, sensor{
+				chip:  chip,
+				label: label,
+				input: input,
+				max:   readInt(prefix + "_max"),
+				crit:  readInt(prefix + "_crit"),
+			})
 		}
 	}
 
-	// If we made it here, then we didn't find anything.
-	return "", fmt.Errorf("no fan file")
+	return sensors
 }
 
-// findFiles goes through the given path and builds a list of files that contain a temperature
-// reading. These files will begin with "temp" and end with "input".
-func findFiles(path string) ([]string, error) {
-	var b []string
+// thermalSensors finds every thermal zone. A zone's "hot" and "critical" trip points are used as
+// its max and critical temperatures.
+func thermalSensors() []sensor {
+	dirs, _ := filepath.Glob(filepath.Join(thermalDir, "thermal_zone*"))
+	sortNumeric(dirs)
 
-	files, err := ioutil.ReadDir(path)
-	if err != nil {
-		return nil, err
+	var sensors []sensor
+	for _, dir := range dirs {
+		s := sensor{
+			chip:  readString(filepath.Join(dir, "type")),
+			label: filepath.Base(dir),
+			input: filepath.Join(dir, "temp"),
+		}
+
+		trips, _ := filepath.Glob(filepath.Join(dir, "trip_point_*_type"))
+		for _, trip := range trips {
+			temp := readInt(strings.TrimSuffix(trip, "_type") + "_temp")
+			switch readString(trip) {
+			case "hot":
+				s.max = temp
+			case "critical":
+				s.crit = temp
+			}
+		}
+
+		sensors = append(sensors, s)
 	}
 
-	for _, file := range files {
-		filename := file.Name()
-		if strings.HasPrefix(filename, "temp") && strings.HasSuffix(filename, "input") {
-			// We found a temperature reading. Add it to the list.
-			b = append(b, filepath.Join(path, filename))
+	return sensors
+}
+
+// matchSensors returns the sensors that match name, which is either a chip or a chip and a label
+// separated by a colon.
+func matchSensors(sensors []sensor, name string) []sensor {
+	chip, label := name, ""
+	if i := strings.Index(name, ":"); i >= 0 {
+		chip, label = name[:i], name[i+1:]
+	}
+
+	var matches []sensor
+	for _, s := range sensors {
+		if !strings.EqualFold(s.chip, chip) {
+			continue
+		}
+		if label != "" && !strings.EqualFold(s.label, label) {
+			continue
 		}
+		matches = append(matches, s)
+	}
+
+	return matches
+}
+
+// sortNumeric sorts the paths by the number in their base names, so that "hwmon2" comes before
+// "hwmon10". Paths with the same number are sorted as strings.
+func sortNumeric(paths []string) {
+	sort.Slice(paths, func(i, j int) bool {
+		a, b := pathNumber(paths[i]), pathNumber(paths[j])
+		if a != b {
+			return a < b
+		}
+		return paths[i] < paths[j]
+	})
+}
+
+// pathNumber returns the first number in the path's base name, or -1 if it doesn't have one.
+func pathNumber(path string) int {
+	base := filepath.Base(path)
+	start := strings.IndexAny(base, "0123456789")
+	if start < 0 {
+		return -1
+	}
+
+	end := start
+	for end < len(base) && base[end] >= '0' && base[end] <= '9' {
+		end++
 	}
 
-	// Make sure we found something.
-	if len(b) == 0 {
-		return nil, fmt.Errorf("no temperature files")
+	n, err := strconv.Atoi(base[start:end])
+	if err != nil {
+		return -1
+	}
+
+	return n
+}
+
+// readInt reads out the value from the file at the provided path, or 0 if it can't be read.
+func readInt(path string) int {
+	n, err := strconv.Atoi(readString(path))
+	if err != nil || n < 0 {
+		return 0
+	}
+
+	return n
+}
+
+// readString reads out the contents of the file at the provided path, or an empty string if it
+// can't be read.
+func readString(path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
 	}
 
-	return b, nil
+	return strings.TrimSpace(string(b))
 }
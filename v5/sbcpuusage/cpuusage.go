@@ -3,29 +3,90 @@ package sbcpuusage
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
+
+	"github.com/snhilde/statusbar/v5/graph"
 )
 
 var colorEnd = "^d^"
 
+// statPath is the file that the kernel reports CPU time in.
+var statPath = "/proc/stat"
+
+// cpuDir is the directory that the kernel lists each CPU's frequency scaling information in.
+var cpuDir = "/sys/devices/system/cpu"
+
+// These are the modes for displaying CPU usage, set with SetMode.
+const (
+	// Aggregate shows the usage of all cores combined, e.g. "23% CPU". This is the default.
+	Aggregate = iota
+
+	// PerCore shows the usage of each core as a block character, e.g. "▂▅▁█ CPU".
+	PerCore
+
+	// PerCoreBars shows the usage of each core as a small bar, e.g. "▌ █ ▎ ▊ CPU".
+	PerCoreBars
+
+	// MaxCore shows the usage of the busiest core, e.g. "87% CPU max".
+	MaxCore
+
+	// IOWait shows the usage of all cores combined followed by the percentage of time spent waiting
+	// on I/O and the percentage stolen by the hypervisor, e.g. "23% CPU 4%io 0%st".
+	IOWait
+)
+
 // Routine is the main object for this package.
 type Routine struct {
 	// Error encountered along the way, if any.
 	err error
 
-	// Number of threads per CPU core.
-	threads int
+	// Whether or not the CPU stats were read in New.
+	ok bool
 
-	// CPU stats from last read.
+	// CPU stats from last read, for all cores combined and for each core.
 	oldStats stats
+	oldCores []stats
 
 	// Percentage of CPU currently being used.
 	perc int
 
+	// Percentage of each core currently being used.
+	cores []int
+
+	// Percentage of time spent waiting on I/O and stolen by the hypervisor.
+	iowait int
+	steal  int
+
+	// Average and highest current frequency of the cores, in kHz. These are 0 if the frequency is
+	// not known.
+	freqAvg int
+	freqMax int
+
+	// Active scaling governor, or energy-performance preference if the CPU has one.
+	governor string
+
+	// Display mode, as set with SetMode.
+	mode int
+
+	// Whether or not to show the frequency, as set with ShowFrequency.
+	showFreq bool
+
+	// Whether or not to show the governor, as set with ShowGovernor.
+	showGovernor bool
+
+	// Recent usage percentages, for drawing the graph.
+	history *graph.Ring
+
+	// Number of samples to show in the graph, as set with ShowGraph. If this is 0, then the graph
+	// is not shown.
+	graphLen int
+
 	// Trio of user-provided colors for displaying various states.
 	colors struct {
 		normal  string
@@ -34,12 +95,17 @@ type Routine struct {
 	}
 }
 
-// stats holds values of different CPU stats.
+// stats holds values of different CPU stats, in units of time. Time spent running guests is already
+// counted in user and nice, so it isn't kept separately.
 type stats struct {
-	user int
-	nice int
-	sys  int
-	idle int
+	user    int
+	nice    int
+	sys     int
+	idle    int
+	iowait  int
+	irq     int
+	softirq int
+	steal   int
 }
 
 // New gets current CPU stats and makes a new routine object. colors is an optional triplet of hex
@@ -50,9 +116,6 @@ type stats struct {
 func New(colors ...[3]string) *Routine {
 	var r Routine
 
-	// Set this now so we can key off it in Update to determine whether or not New was successful.
-	r.threads = -1
-
 	// Store the color codes. Don't do any validation.
 	if len(colors) > 0 {
 		r.colors.normal = "^c" + colors[0][0] + "^"
@@ -63,18 +126,43 @@ func New(colors ...[3]string) *Routine {
 		colorEnd = ""
 	}
 
-	// Find out how many threads the CPU has.
-	r.threads, r.err = numThreads()
-	if r.err != nil {
-		return &r
+	r.oldStats, r.oldCores, r.err = readStats()
+	r.ok = r.err == nil
+
+	return &r
+}
+
+// SetMode sets how CPU usage is displayed. mode is one of Aggregate, PerCore, PerCoreBars, MaxCore,
+// or IOWait.
+func (r *Routine) SetMode(mode int) error {
+	if r == nil {
+		return fmt.Errorf("bad routine")
 	}
 
-	err := readStats(&(r.oldStats))
-	if err != nil {
-		r.err = err
+	if mode < Aggregate || mode > IOWait {
+		return fmt.Errorf("invalid mode")
 	}
 
-	return &r
+	r.mode = mode
+	return nil
+}
+
+// ShowFrequency shows the average and highest current frequency of the cores after the usage, e.g.
+// "23% CPU 1.8/3.4GHz". A highest frequency that stays low under load can be a sign of thermal
+// throttling.
+func (r *Routine) ShowFrequency(enable bool) {
+	if r != nil {
+		r.showFreq = enable
+	}
+}
+
+// ShowGovernor shows the active frequency scaling governor after the usage, e.g.
+// "23% CPU powersave". If the CPU has an energy-performance preference (like with the intel_pstate
+// and amd-pstate drivers), then that is shown instead, e.g. "23% CPU balance_power".
+func (r *Routine) ShowGovernor(enable bool) {
+	if r != nil {
+		r.showGovernor = enable
+	}
 }
 
 // Update gets the current CPU stats, compares them to the last-read stats, and calculates the
@@ -85,37 +173,42 @@ func (r *Routine) Update() (bool, error) {
 	}
 
 	// Handle error in New.
-	if r.threads < 0 {
+	if !r.ok {
 		return false, r.err
 	}
 
-	var newStats stats
-	err := readStats(&newStats)
+	newStats, newCores, err := readStats()
 	if err != nil {
 		r.err = err
 		return true, err
 	}
 
-	used := (newStats.user - r.oldStats.user) + (newStats.nice - r.oldStats.nice) + (newStats.sys - r.oldStats.sys)
-	total := used + (newStats.idle - r.oldStats.idle)
-	total *= r.threads
-
-	// Prevent divide-by-zero error
-	if total == 0 {
-		r.perc = 0
-	} else {
-		r.perc = (used * 100) / total
-		if r.perc < 0 {
-			r.perc = 0
-		} else if r.perc > 100 {
-			r.perc = 100
+	diff := newStats.sub(r.oldStats)
+	r.perc = diff.usage()
+	r.iowait = percent(diff.iowait, diff.total())
+	r.steal = percent(diff.steal, diff.total())
+
+	// Cores can come and go when they are taken offline, which shifts the lines around. If that
+	// happened, then wait for the next update to compare them.
+	r.cores = make([]int, len(newCores))
+	if len(newCores) == len(r.oldCores) {
+		for i := range newCores {
+			r.cores[i] = newCores[i].sub(r.oldCores[i]).usage()
 		}
 	}
 
-	r.oldStats.user = newStats.user
-	r.oldStats.nice = newStats.nice
-	r.oldStats.sys = newStats.sys
-	r.oldStats.idle = newStats.idle
+	r.oldStats = newStats
+	r.oldCores = newCores
+
+	// Not every system has frequency scaling, so this is only shown if it's available.
+	r.freqAvg, r.freqMax = readFrequency()
+	if r.showGovernor {
+		r.governor = readGovernor()
+	}
+
+	if r.history != nil {
+		r.history.Push(float64(r.perc))
+	}
 
 	return true, nil
 }
@@ -128,15 +221,49 @@ func (r *Routine) String() string {
 
 	var c string
 
-	if r.perc < 75 {
+	// Color by the busiest core when that's what is shown.
+	perc := r.perc
+	if r.mode == MaxCore {
+		perc = r.maxCore()
+	}
+
+	if perc < 75 {
 		c = r.colors.normal
-	} else if r.perc < 90 {
+	} else if perc < 90 {
 		c = r.colors.warning
 	} else {
 		c = r.colors.error
 	}
 
-	return fmt.Sprintf("%s%2d%% CPU%s", c, r.perc, colorEnd)
+	var s string
+	switch r.mode {
+	case PerCore:
+		s = graph.Sparkline(r.coreValues(), 0, 100) + " CPU"
+	case PerCoreBars:
+		bars := make([]string, len(r.cores))
+		for i, perc := range r.cores {
+			bars[i] = graph.Bar(float64(perc), 0, 100, 1)
+		}
+		s = strings.Join(bars, " ") + " CPU"
+	case MaxCore:
+		s = fmt.Sprintf("%2d%% CPU max", perc)
+	case IOWait:
+		s = fmt.Sprintf("%2d%% CPU %d%%io %d%%st", r.perc, r.iowait, r.steal)
+	default:
+		s = fmt.Sprintf("%2d%% CPU", r.perc)
+	}
+
+	if r.graphLen > 0 {
+		s += " " + graph.Sparkline(r.history.Last(r.graphLen), 0, 100)
+	}
+	if r.showFreq && r.freqMax > 0 {
+		s += fmt.Sprintf(" %.1f/%.1fGHz", float64(r.freqAvg)/1e6, float64(r.freqMax)/1e6)
+	}
+	if r.showGovernor && r.governor != "" {
+		s += " " + r.governor
+	}
+
+	return c + s + colorEnd
 }
 
 // Error formats and returns an error message.
@@ -157,50 +284,297 @@ func (r *Routine) Name() string {
 	return "CPU Usage"
 }
 
-// The shell command 'lscpu' returns a variety of CPU information, including the number of threads
-// per CPU core. We don't care about the number of cores, because we're already reading in the
-// averaged total. We only want to know if we need to be changing its range. To get this number,
-// we're going to loop through each line of the output until we find "Thread(s) per socket".
-func numThreads() (int, error) {
-	proc := exec.Command("lscpu")
-	out, err := proc.Output()
-	if err != nil {
-		return -1, err
+// Metrics returns the percentage of CPU currently being used, the percentage of time spent waiting
+// on I/O and stolen by the hypervisor, the usage of the busiest core, the usage of each core (as
+// "core0", "core1", and so on), and the average and highest frequency of the cores in MHz if they
+// are known.
+func (r *Routine) Metrics() map[string]float64 {
+	if r == nil {
+		return nil
 	}
 
-	lines := strings.Split(string(out), "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "Thread(s) per core") {
-			fields := strings.Fields(line)
-			if len(fields) != 4 {
-				return -1, fmt.Errorf("invalid fields")
-			}
-			return strconv.Atoi(fields[3])
+	m := map[string]float64{
+		"usage":    float64(r.perc),
+		"iowait":   float64(r.iowait),
+		"steal":    float64(r.steal),
+		"max_core": float64(r.maxCore()),
+	}
+	for i, perc := range r.cores {
+		m["core"+strconv.Itoa(i)] = float64(perc)
+	}
+	if r.freqMax > 0 {
+		m["freq_avg_mhz"] = float64(r.freqAvg) / 1000
+		m["freq_max_mhz"] = float64(r.freqMax) / 1000
+	}
+
+	return m
+}
+
+// ShowGraph displays a sparkline of the last samples readings after the current percentage.
+func (r *Routine) ShowGraph(samples int) {
+	if r == nil || samples < 1 {
+		return
+	}
+
+	r.graphLen = samples
+	r.history = graph.NewRing(samples)
+}
+
+// savedData is the routine's data that is saved across restarts.
+type savedData struct {
+	Perc    int `json:"perc"`
+	User    int `json:"user"`
+	Nice    int `json:"nice"`
+	Sys     int `json:"sys"`
+	Idle    int `json:"idle"`
+	IOWait  int `json:"iowait"`
+	IRQ     int `json:"irq"`
+	SoftIRQ int `json:"softirq"`
+	Steal   int `json:"steal"`
+}
+
+// Save returns the current percentage and CPU stats so that they can be used as a baseline after a
+// restart.
+func (r *Routine) Save() ([]byte, error) {
+	if r == nil {
+		return nil, fmt.Errorf("bad routine")
+	}
+
+	return json.Marshal(savedData{
+		Perc:    r.perc,
+		User:    r.oldStats.user,
+		Nice:    r.oldStats.nice,
+		Sys:     r.oldStats.sys,
+		Idle:    r.oldStats.idle,
+		IOWait:  r.oldStats.iowait,
+		IRQ:     r.oldStats.irq,
+		SoftIRQ: r.oldStats.softirq,
+		Steal:   r.oldStats.steal,
+	})
+}
+
+// Restore loads the percentage and CPU stats previously returned by Save. The saved stats are only
+// used as the baseline if they came from the current boot, i.e. none of them are ahead of the stats
+// read in New. The usage of each core is not saved, so it starts over after a restart.
+func (r *Routine) Restore(data []byte) error {
+	if r == nil {
+		return fmt.Errorf("bad routine")
+	}
+
+	saved := savedData{}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	r.perc = saved.Perc
+
+	old := stats{
+		user:    saved.User,
+		nice:    saved.Nice,
+		sys:     saved.Sys,
+		idle:    saved.Idle,
+		iowait:  saved.IOWait,
+		irq:     saved.IRQ,
+		softirq: saved.SoftIRQ,
+		steal:   saved.Steal,
+	}
+
+	// Data saved by older versions doesn't have the I/O wait time. Using it as the baseline would
+	// count all of the I/O wait time since boot in the next update.
+	if old.iowait == 0 && r.oldStats.iowait > 0 {
+		return nil
+	}
+
+	diff := r.oldStats.sub(old)
+	if diff.user >= 0 && diff.nice >= 0 && diff.sys >= 0 && diff.idle >= 0 && diff.iowait >= 0 &&
+		diff.irq >= 0 && diff.softirq >= 0 && diff.steal >= 0 {
+		r.oldStats = old
+	}
+
+	return nil
+}
+
+// maxCore returns the usage of the busiest core.
+func (r *Routine) maxCore() int {
+	max := 0
+	for _, perc := range r.cores {
+		if perc > max {
+			max = perc
 		}
 	}
 
-	// If we made it this far, then we didn't find anything.
-	return -1, fmt.Errorf("failed to find number of threads")
+	return max
+}
+
+// coreValues returns the usage of each core for graphing.
+func (r *Routine) coreValues() []float64 {
+	values := make([]float64, len(r.cores))
+	for i, perc := range r.cores {
+		values[i] = float64(perc)
+	}
+
+	return values
+}
+
+// sub returns the difference between these stats and the old stats.
+func (s stats) sub(old stats) stats {
+	return stats{
+		user:    s.user - old.user,
+		nice:    s.nice - old.nice,
+		sys:     s.sys - old.sys,
+		idle:    s.idle - old.idle,
+		iowait:  s.iowait - old.iowait,
+		irq:     s.irq - old.irq,
+		softirq: s.softirq - old.softirq,
+		steal:   s.steal - old.steal,
+	}
+}
+
+// total returns the total amount of time in the stats.
+func (s stats) total() int {
+	return s.user + s.nice + s.sys + s.idle + s.iowait + s.irq + s.softirq + s.steal
+}
+
+// usage returns the percentage of time spent doing work. Time spent idle or waiting on I/O is not
+// counted as work.
+func (s stats) usage() int {
+	return percent(s.total()-s.idle-s.iowait, s.total())
 }
 
-// readStats opens /proc/stat and reads out the CPU stats from the first line.
-func readStats(newStats *stats) error {
-	// The first line of /proc/stat will look like this:
-	// "cpu userVal niceVal sysVal idleVal ..."
-	f, err := os.Open("/proc/stat")
+// percent calculates the percentage that part is of total, between 0 and 100.
+func percent(part int, total int) int {
+	// Prevent divide-by-zero error
+	if total <= 0 {
+		return 0
+	}
+
+	perc := (part * 100) / total
+	if perc < 0 {
+		perc = 0
+	} else if perc > 100 {
+		perc = 100
+	}
+
+	return perc
+}
+
+// readStats reads the CPU stats for all cores combined and for each core from /proc/stat. The lines
+// look like this, with values that older kernels don't have left off the end:
+// "cpu  user nice sys idle iowait irq softirq steal guest guest_nice"
+// "cpu0 user nice sys idle iowait irq softirq steal guest guest_nice"
+func readStats() (stats, []stats, error) {
+	f, err := os.Open(statPath)
 	if err != nil {
-		return err
+		return stats{}, nil, err
 	}
 	defer f.Close()
 
-	reader := bufio.NewReader(f)
+	var total stats
+	found := false
+	cores := make([]stats, 0)
 
-	line, err := reader.ReadString('\n')
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+
+		s, err := parseStats(fields[1:])
+		if err != nil {
+			return stats{}, nil, err
+		}
+
+		if fields[0] == "cpu" {
+			total = s
+			found = true
+		} else {
+			cores = append(cores, s)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return stats{}, nil, err
+	}
+
+	if !found {
+		return stats{}, nil, fmt.Errorf("failed to find CPU stats")
+	}
+
+	return total, cores, nil
+}
+
+// readFrequency reads the current frequency of every core and returns the average and highest
+// frequency in kHz. Both are 0 if the frequency can't be read.
+func readFrequency() (int, int) {
+	paths, _ := filepath.Glob(filepath.Join(cpuDir, "cpu[0-9]*", "cpufreq", "scaling_cur_freq"))
+
+	sum, max, n := 0, 0, 0
+	for _, path := range paths {
+		freq, err := readInt(path)
+		if err != nil {
+			continue
+		}
+		sum += freq
+		n++
+		if freq > max {
+			max = freq
+		}
+	}
+
+	if n == 0 {
+		return 0, 0
+	}
+
+	return sum / n, max
+}
+
+// readGovernor reads the energy-performance preference of the first core, or its scaling governor
+// if it doesn't have one. This returns an empty string if neither can be read.
+func readGovernor() string {
+	paths, _ := filepath.Glob(filepath.Join(cpuDir, "cpu[0-9]*", "cpufreq"))
+	for _, path := range paths {
+		for _, name := range []string{"energy_performance_preference", "scaling_governor"} {
+			if b, err := ioutil.ReadFile(filepath.Join(path, name)); err == nil {
+				if governor := strings.TrimSpace(string(b)); governor != "" {
+					return governor
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// readInt reads out the value from the file at the provided path.
+func readInt(path string) (int, error) {
+	b, err := ioutil.ReadFile(path)
 	if err != nil {
-		return err
+		return -1, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// parseStats parses the values from a line of CPU stats. At least the first four values must be
+// present.
+func parseStats(fields []string) (stats, error) {
+	var values [8]int
+	for i := 0; i < len(values) && i < len(fields); i++ {
+		v, err := strconv.Atoi(fields[i])
+		if err != nil {
+			return stats{}, err
+		}
+		values[i] = v
 	}
 
-	// Error will be handled in String().
-	_, err = fmt.Sscanf(line, "cpu %v %v %v %v", &(newStats.user), &(newStats.nice), &(newStats.sys), &(newStats.idle))
-	return err
+	return stats{
+		user:    values[0],
+		nice:    values[1],
+		sys:     values[2],
+		idle:    values[3],
+		iowait:  values[4],
+		irq:     values[5],
+		softirq: values[6],
+		steal:   values[7],
+	}, nil
 }
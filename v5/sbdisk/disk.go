@@ -1,22 +1,80 @@
-// Package sbdisk displays disk resources for each filesystem provided.
+// Package sbdisk displays disk resources for each filesystem provided or mounted.
 package sbdisk
 
 import (
+	"bufio"
 	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 )
 
 var colorEnd = "^d^"
 
+// mountinfoPath is the file that the kernel lists the mounted filesystems in.
+var mountinfoPath = "/proc/self/mountinfo"
+
+// diskstatsPath is the file that the kernel reports I/O statistics for each block device in.
+var diskstatsPath = "/proc/diskstats"
+
+// sectorSize is the size of the sectors counted in /proc/diskstats, which is always 512 bytes no
+// matter what the device's real sector size is.
+const sectorSize = 512
+
+// skipTypes are the filesystem types that are skipped when finding filesystems automatically. These
+// either don't take up disk space or aren't worth showing.
+var skipTypes = map[string]bool{
+	"autofs": true, "binfmt_misc": true, "bpf": true, "cgroup": true, "cgroup2": true,
+	"configfs": true, "debugfs": true, "devpts": true, "devtmpfs": true, "efivarfs": true,
+	"fusectl": true, "hugetlbfs": true, "mqueue": true, "nsfs": true, "overlay": true, "proc": true,
+	"pstore": true, "ramfs": true, "rpc_pipefs": true, "securityfs": true, "selinuxfs": true,
+	"squashfs": true, "sysfs": true, "tmpfs": true, "tracefs": true,
+}
+
+// networkTypes are the network filesystem types, which are also skipped when finding filesystems
+// automatically. Checking the stats of a network filesystem whose server isn't responding can hang.
+var networkTypes = map[string]bool{
+	"9p": true, "afs": true, "ceph": true, "cifs": true, "glusterfs": true, "lustre": true,
+	"ncpfs": true, "nfs": true, "nfs4": true, "smb3": true, "smbfs": true, "sshfs": true,
+}
+
 // Routine is the main object for this package.
 type Routine struct {
 	// Error encountered along the way, if any.
 	err error
 
-	// Slice of provided filesystems to stat.
+	// Provided filesystem paths to stat. If this is empty, then the filesystems are found
+	// automatically.
+	paths []string
+
+	// Slice of filesystems to stat.
 	disks []fs
 
+	// Filesystem types to show when finding filesystems automatically, as set with FilterTypes.
+	types []string
+
+	// Mount point patterns to show when finding filesystems automatically, as set with
+	// FilterMounts.
+	patterns []string
+
+	// Whether or not to show inode usage, as set with ShowInodes.
+	inodes bool
+
+	// Whether or not to show I/O throughput and utilization, as set with ShowIO.
+	io bool
+
+	// I/O stats from last read, keyed by device number, and when they were read.
+	oldIO   map[string]ioStats
+	oldTime time.Time
+
+	// Mount points that have been seen mounted read-write, for noticing when they are remounted
+	// read-only.
+	seenRW map[string]bool
+
 	// Trio of user-provided colors for displaying various states.
 	colors struct {
 		normal  string
@@ -46,21 +104,64 @@ type fs struct {
 	// Note: Bavail is the amount of blocks that can actually be used, while Bfree is the total
 	//       amount of unused blocks.
 	perc uint64
+
+	// Percentage of inodes used, or -1 if the filesystem doesn't have a fixed number of inodes.
+	inodePerc int
+
+	// Whether or not the filesystem was remounted read-only after being mounted read-write.
+	remountedRO bool
+
+	// Device number of the filesystem's block device, e.g. "8:1", or empty if it isn't known.
+	dev string
+
+	// Bytes read and written per second, and percentage of time that the device was busy, since the
+	// last update. These are -1 if they aren't known.
+	readRate  int64
+	writeRate int64
+	util      int
+}
+
+// ioStats holds the I/O counters of a single block device.
+type ioStats struct {
+	// Sectors read and written.
+	read    uint64
+	written uint64
+
+	// Milliseconds spent doing I/O.
+	busy uint64
+}
+
+// mount holds information about a single mounted filesystem.
+type mount struct {
+	// Device number of the filesystem, e.g. "8:1".
+	dev string
+
+	// Path that the filesystem is mounted on.
+	point string
+
+	// Type of the filesystem, e.g. "ext4".
+	fstype string
+
+	// Whether or not this mount of the filesystem is read-only.
+	ro bool
+
+	// Whether or not the filesystem itself is read-only. The kernel can make a filesystem read-only
+	// when it finds errors, which leaves every mount of it read-only.
+	superRO bool
 }
 
-// New copies over the provided filesystem paths and makes a new routine object. colors is an
-// optional triplet of hex color codes for colorizing the output based on these rules:
+// New copies over the provided filesystem paths and makes a new routine object. If no paths are
+// provided, then the routine finds the mounted filesystems automatically on every update, skipping
+// filesystems like tmpfs, overlay, and squashfs, network filesystems, and filesystems that can't be
+// checked. colors is an optional triplet of hex color codes for colorizing the output based on
+// these rules:
 //   1. Normal color, disk is less than 75% full.
 //   2. Warning color, disk is between 75% and 90% full.
-//   3. Error color, disk is over 90% full.
+//   3. Error color, disk is over 90% full or was remounted read-only.
+// If I/O is shown with ShowIO, then the device's utilization is colored by the same rules.
 func New(paths []string, colors ...[3]string) *Routine {
 	var r Routine
 
-	if len(paths) == 0 {
-		r.err = fmt.Errorf("no paths provided")
-		return &r
-	}
-
 	// Store the color codes. Don't do any validation.
 	if len(colors) > 0 {
 		r.colors.normal = "^c" + colors[0][0] + "^"
@@ -71,47 +172,132 @@ func New(paths []string, colors ...[3]string) *Routine {
 		colorEnd = ""
 	}
 
-	// We want to do this after checking the colors so we can know in Update if New was successful
-	// or not.
-	for _, path := range paths {
-		r.disks = append(r.disks, fs{path: path})
-	}
+	r.paths = paths
+	r.seenRW = make(map[string]bool)
 
 	return &r
 }
 
+// FilterTypes shows only filesystems of these types (e.g. "ext4" or "btrfs") when finding
+// filesystems automatically. This also allows types that are skipped by default, like network
+// filesystems (e.g. "nfs4" or "cifs"). Filesystems that can't be checked are skipped.
+func (r *Routine) FilterTypes(types ...string) {
+	if r != nil {
+		r.types = types
+	}
+}
+
+// FilterMounts shows only filesystems mounted on paths that match one of these patterns (e.g. "/"
+// or "/mnt/*") when finding filesystems automatically. The patterns use the syntax of path.Match.
+func (r *Routine) FilterMounts(patterns ...string) {
+	if r != nil {
+		r.patterns = patterns
+	}
+}
+
+// ShowInodes shows the percentage of inodes used after the space used, e.g. "/: 20G/100G 5%i".
+// Filesystems that don't have a fixed number of inodes, like btrfs, don't show it.
+func (r *Routine) ShowInodes(enable bool) {
+	if r != nil {
+		r.inodes = enable
+	}
+}
+
+// ShowIO shows how many bytes per second are read from and written to each filesystem's block
+// device, and the percentage of time that the device was busy, e.g. "/: 20G/100G r:1M/s w:300K/s
+// 12%io". These are measured between updates, so they are shown starting with the second update.
+// Filesystems without a block device of their own, like btrfs subvolumes, don't show them.
+func (r *Routine) ShowIO(enable bool) {
+	if r != nil {
+		r.io = enable
+	}
+}
+
 // Update gets the amount of used and total disk space and converts them into a human-readable size
-// for each provided filesystem.
+// for each filesystem.
 func (r *Routine) Update() (bool, error) {
 	if r == nil {
 		return false, fmt.Errorf("bad routine")
 	}
 
-	// Handle error in New.
-	if len(r.disks) == 0 {
-		return false, r.err
+	// The mounts are needed to find filesystems automatically. Otherwise, they're only used to tell
+	// when a filesystem is read-only.
+	mounts, err := readMounts()
+	if err != nil && len(r.paths) == 0 {
+		r.err = fmt.Errorf("error reading mounts")
+		return true, err
 	}
 
-	for i, disk := range r.disks {
-		var b syscall.Statfs_t
-		err := syscall.Statfs(disk.path, &b)
+	if len(r.paths) == 0 {
+		r.disks = nil
+		for _, m := range r.filterMounts(mounts) {
+			r.disks = append(r.disks, fs{path: m.point})
+		}
+	} else if len(r.disks) == 0 {
+		for _, path := range r.paths {
+			r.disks = append(r.disks, fs{path: path})
+		}
+	}
+
+	var newIO map[string]ioStats
+	now := time.Now()
+	if r.io {
+		newIO, err = readIO()
 		if err != nil {
+			r.err = fmt.Errorf("error reading I/O stats")
+			return true, err
+		}
+	}
+
+	// Filesystems that were found automatically might have gone away or become unreachable since
+	// they were read from the mounts, so we skip the ones that we can't check.
+	disks := r.disks[:0]
+	for _, disk := range r.disks {
+		if err := disk.stat(); err != nil {
+			if len(r.paths) == 0 {
+				continue
+			}
 			r.err = fmt.Errorf("error checking stats")
 			return true, err
 		}
 
-		total := b.Blocks * uint64(b.Bsize)
-		used := total - (b.Bavail * uint64(b.Bsize))
-		r.disks[i].perc = (used * 100) / total
+		disk.remountedRO = false
+		disk.dev = ""
+		if m, ok := findMount(mounts, disk.path); ok {
+			disk.dev = m.dev
+			if m.ro || m.superRO {
+				// A filesystem that the kernel made read-only while this mount is still read-write
+				// was remounted because of errors.
+				disk.remountedRO = r.seenRW[m.point] || (m.superRO && !m.ro)
+			} else {
+				r.seenRW[m.point] = true
+			}
+		}
+
+		disk.readRate, disk.writeRate, disk.util = -1, -1, -1
+		newStats, ok := newIO[disk.dev]
+		oldStats, hadOld := r.oldIO[disk.dev]
+		if ok && hadOld {
+			elapsed := now.Sub(r.oldTime)
+			disk.readRate, disk.writeRate, disk.util = ioRates(oldStats, newStats, elapsed)
+		}
+
+		disks = append(disks, disk)
+	}
+	r.disks = disks
 
-		r.disks[i].used, r.disks[i].usedUnit = shrink(used)
-		r.disks[i].total, r.disks[i].totalUnit = shrink(total)
+	if len(r.disks) == 0 {
+		r.err = fmt.Errorf("no filesystems found")
+		return true, r.err
 	}
 
+	r.oldIO = newIO
+	r.oldTime = now
+
 	return true, nil
 }
 
-// String formats and prints the amounts of disk space for each provided filesystem.
+// String formats and prints the amounts of disk space for each filesystem.
 func (r *Routine) String() string {
 	if r == nil {
 		return "bad routine"
@@ -120,9 +306,9 @@ func (r *Routine) String() string {
 	c := ""
 	b := new(strings.Builder)
 	for i, disk := range r.disks {
-		if disk.perc > 90 {
+		if disk.perc > 90 || disk.util > 90 || disk.remountedRO {
 			c = r.colors.error
-		} else if disk.perc > 75 {
+		} else if disk.perc > 75 || disk.util > 75 {
 			c = r.colors.warning
 		} else {
 			c = r.colors.normal
@@ -132,7 +318,19 @@ func (r *Routine) String() string {
 			b.WriteString(", ")
 		}
 		b.WriteString(c)
-		fmt.Fprintf(b, "%s: %v%c/%v%c", disk.path, disk.used, disk.usedUnit, disk.total, disk.totalUnit)
+		fmt.Fprintf(b, "%s: %v%c/%v%c", disk.path, disk.used, disk.usedUnit, disk.total,
+			disk.totalUnit)
+		if r.inodes && disk.inodePerc >= 0 {
+			fmt.Fprintf(b, " %v%%i", disk.inodePerc)
+		}
+		if r.io && disk.util >= 0 {
+			read, readUnit := shrink(uint64(disk.readRate))
+			write, writeUnit := shrink(uint64(disk.writeRate))
+			fmt.Fprintf(b, " r:%v%c/s w:%v%c/s %v%%io", read, readUnit, write, writeUnit, disk.util)
+		}
+		if disk.remountedRO {
+			b.WriteString(" RO")
+		}
 		b.WriteString(colorEnd)
 	}
 
@@ -157,6 +355,238 @@ func (r *Routine) Name() string {
 	return "Disk"
 }
 
+// stat gets the amount of used and total space and the inode usage of the filesystem.
+func (d *fs) stat() error {
+	var b syscall.Statfs_t
+	if err := syscall.Statfs(d.path, &b); err != nil {
+		return err
+	}
+
+	total := b.Blocks * uint64(b.Bsize)
+	used := total - (b.Bavail * uint64(b.Bsize))
+	d.perc = 0
+	if total > 0 {
+		d.perc = (used * 100) / total
+	}
+
+	d.used, d.usedUnit = shrink(used)
+	d.total, d.totalUnit = shrink(total)
+
+	d.inodePerc = -1
+	if b.Files > 0 {
+		d.inodePerc = int(((b.Files - b.Ffree) * 100) / b.Files)
+	}
+
+	return nil
+}
+
+// filterMounts picks out the mounts to show when finding filesystems automatically. If a filesystem
+// is mounted in more than one place, like with bind mounts, then only the shortest mount point is
+// kept.
+func (r *Routine) filterMounts(mounts []mount) []mount {
+	byDev := make(map[string]mount)
+	for _, m := range mounts {
+		if len(r.types) > 0 {
+			if !contains(r.types, m.fstype) {
+				continue
+			}
+		} else if skipType(m.fstype) {
+			continue
+		}
+
+		if len(r.patterns) > 0 {
+			matched := false
+			for _, pattern := range r.patterns {
+				if ok, _ := path.Match(pattern, m.point); ok {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		if old, ok := byDev[m.dev]; !ok || len(m.point) < len(old.point) {
+			byDev[m.dev] = m
+		}
+	}
+
+	filtered := make([]mount, 0, len(byDev))
+	for _, m := range byDev {
+		filtered = append(filtered, m)
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].point < filtered[j].point
+	})
+
+	return filtered
+}
+
+// skipType reports whether or not filesystems of the type are skipped by default when finding
+// filesystems automatically.
+func skipType(fstype string) bool {
+	return skipTypes[fstype] || networkTypes[fstype] || strings.HasPrefix(fstype, "fuse.")
+}
+
+// readMounts reads the mounted filesystems from /proc/self/mountinfo. Each line looks like this,
+// with any number of optional fields before the separator:
+// "36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue"
+func readMounts() ([]mount, error) {
+	f, err := os.Open(mountinfoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mounts []mount
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 0 || sep+3 >= len(fields) {
+			continue
+		}
+
+		mounts = append(mounts, mount{
+			dev:     fields[2],
+			point:   unescape(fields[4]),
+			fstype:  fields[sep+1],
+			ro:      contains(strings.Split(fields[5], ","), "ro"),
+			superRO: contains(strings.Split(fields[sep+3], ","), "ro"),
+		})
+	}
+
+	return mounts, scanner.Err()
+}
+
+// readIO reads the I/O stats of every block device from /proc/diskstats, keyed by device number.
+// Each line has the device's numbers and name followed by its counters, with more counters at the
+// end on newer kernels:
+// "8 1 sda1 reads merged sectors_read ms_reading writes merged sectors_written ms_writing ..."
+// Only the sectors read and written and the time spent doing I/O (the tenth counter) are kept.
+func readIO() (map[string]ioStats, error) {
+	f, err := os.Open(diskstatsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stats := make(map[string]ioStats)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 14 {
+			continue
+		}
+
+		var values [3]uint64
+		for i, field := range []string{fields[5], fields[9], fields[12]} {
+			if values[i], err = strconv.ParseUint(field, 10, 64); err != nil {
+				return nil, err
+			}
+		}
+
+		dev := fields[0] + ":" + fields[1]
+		stats[dev] = ioStats{read: values[0], written: values[1], busy: values[2]}
+	}
+
+	return stats, scanner.Err()
+}
+
+// isAfter checks that none of the counters went backward since the old stats, which happens when a
+// device is removed and another one takes its number.
+func (s ioStats) isAfter(old ioStats) bool {
+	return s.read >= old.read && s.written >= old.written && s.busy >= old.busy
+}
+
+// ioRates calculates the bytes read and written per second and the percentage of time that the
+// device was busy between two reads of its stats, elapsed apart. These are -1 if the stats can't be
+// compared, like when the counters were reset.
+func ioRates(prev ioStats, cur ioStats, elapsed time.Duration) (int64, int64, int) {
+	ms := uint64(elapsed.Milliseconds())
+	if ms == 0 || !cur.isAfter(prev) {
+		return -1, -1, -1
+	}
+
+	read := rate((cur.read-prev.read)*sectorSize, elapsed)
+	write := rate((cur.written-prev.written)*sectorSize, elapsed)
+	util := int(((cur.busy - prev.busy) * 100) / ms)
+	if util > 100 {
+		util = 100
+	}
+
+	return read, write, util
+}
+
+// rate converts an amount of bytes over a period of time into bytes per second.
+func rate(bytes uint64, elapsed time.Duration) int64 {
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return int64(float64(bytes) / elapsed.Seconds())
+}
+
+// findMount finds the mount that the path is on, which is the last mount whose mount point contains
+// the path.
+func findMount(mounts []mount, p string) (mount, bool) {
+	p = path.Clean(p)
+
+	var found mount
+	ok := false
+	for _, m := range mounts {
+		if m.point == p || m.point == "/" || strings.HasPrefix(p, m.point+"/") {
+			if !ok || len(m.point) >= len(found.point) {
+				found = m
+				ok = true
+			}
+		}
+	}
+
+	return found, ok
+}
+
+// unescape decodes the octal escapes (e.g. "\040" for a space) that the kernel uses for special
+// characters in mountinfo.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	b := new(strings.Builder)
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+// contains checks whether or not the list has the value.
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Shrink iteratively decreases the amount of bytes by a step of 2^10 until human-readable.
 func shrink(blocks uint64) (uint64, rune) {
 	units := []rune{'B', 'K', 'M', 'G', 'T', 'P', 'E'}
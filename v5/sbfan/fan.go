@@ -1,32 +1,37 @@
-// Package sbfan displays the current fan speed in RPM.
+// Package sbfan displays the current speed of the system's fans in RPM.
 package sbfan
 
 import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 var colorEnd = "^d^"
 
-// We need to root around in this directory for the device directory for the fan.
-const baseDir = "/sys/class/hwmon/"
+// We need to root around in this directory for the device directories for the fans.
+var hwmonDir = "/sys/class/hwmon"
 
 // Routine is the main object for this package.
 type Routine struct {
 	// Error encountered along the way, if any.
 	err error
 
-	// Path to file that contains the current speed of the fan, in RPM.
-	fanPath string
+	// Fans that we read the speed of.
+	fans []fan
 
-	// Maximum speed of the fan, in RPM.
-	max int
+	// Fans to show, as set with SetFans. If this is empty, then every fan is shown.
+	labels []string
 
-	// Current speed of the fan, in RPM.
-	speed int
+	// Whether or not to show the speed as a percentage of the maximum speed, as set with
+	// ShowPercent.
+	percent bool
+
+	// Whether or not to show the PWM duty cycle, as set with ShowPWM.
+	pwm bool
 
 	// Trio of user-provided colors for displaying various states.
 	colors struct {
@@ -36,12 +41,37 @@ type Routine struct {
 	}
 }
 
-// New searches around in the base directory for a pair of max and current files and makes a new
-// routine object. colors is an optional triplet of hex color codes for colorizing the output based
-// on these rules:
-//   1. Normal color, fan is running at less than 75% of the maximum RPM.
-//   2. Warning color, fan is running at between 75% and 90% of the maximum RPM.
-//   3. Error color, fan is running at more than 90% of the maximum RPM.
+// fan is a single fan.
+type fan struct {
+	// Name of the hardware monitor that the fan belongs to, e.g. "nct6775".
+	chip string
+
+	// Label of the fan, e.g. "CPU Fan". Fans without a label are named after their file, e.g.
+	// "fan1".
+	label string
+
+	// File that contains the current speed of the fan, in RPM.
+	input string
+
+	// File that contains the PWM duty cycle of the fan (0-255), or empty if it doesn't have one.
+	pwmFile string
+
+	// Maximum speed of the fan in RPM, or 0 if it isn't known.
+	max int
+
+	// Current speed of the fan, in RPM.
+	speed int
+
+	// Current PWM duty cycle of the fan as a percentage, or -1 if it isn't known.
+	duty int
+}
+
+// New makes a new routine object. The fans are found during the first update. colors is an optional
+// triplet of hex color codes for colorizing the output based on these rules:
+//   1. Normal color, fans are running at less than 75% of their maximum RPM.
+//   2. Warning color, a fan is running at between 75% and 90% of its maximum RPM.
+//   3. Error color, a fan is running at more than 90% of its maximum RPM.
+// Fans whose maximum speed isn't known don't affect the color.
 func New(colors ...[3]string) *Routine {
 	var r Routine
 
@@ -55,42 +85,70 @@ func New(colors ...[3]string) *Routine {
 		colorEnd = ""
 	}
 
-	// Find the files holding the values for the maximum fan speed and the current fan speed.
-	maxFile, outFile, err := findFiles()
-	if err != nil {
-		r.err = err
-		return &r
+	return &r
+}
+
+// SetFans chooses which fans to show, by label (e.g. "CPU Fan" or "fan2"). A label can be prefixed
+// with the name of the hardware monitor and a colon (e.g. "nct6775:fan2") to pick a fan from a
+// specific device. Labels are not case-sensitive. Fans are shown in the order given.
+func (r *Routine) SetFans(labels ...string) {
+	if r != nil {
+		r.labels = labels
+		r.fans = nil
 	}
+}
 
-	// Find the max fan speed file and read its value.
-	r.max, r.err = readSpeed(maxFile)
+// ShowPercent shows the speed of each fan as a percentage of its maximum speed instead of in RPM,
+// e.g. "45%/30% FAN". Fans whose maximum speed isn't known are still shown in RPM.
+func (r *Routine) ShowPercent(enable bool) {
+	if r != nil {
+		r.percent = enable
+	}
+}
 
-	r.fanPath = outFile
-	return &r
+// ShowPWM shows the PWM duty cycle of each fan after its speed, e.g. "1200/800 RPM PWM 40%/25%".
+// Fans without PWM control are shown as "-".
+func (r *Routine) ShowPWM(enable bool) {
+	if r != nil {
+		r.pwm = enable
+	}
 }
 
-// Update reads the current fan speed in RPM and calculates the percentage of the maximum speed.
+// Update reads the current speed of each fan.
 func (r *Routine) Update() (bool, error) {
 	if r == nil {
 		return false, fmt.Errorf("bad routine")
 	}
 
-	// Handle any error encountered in New.
-	if r.fanPath == "" || r.max == 0 {
-		return false, r.err
+	if len(r.fans) == 0 {
+		fans, err := r.findFans()
+		if err != nil {
+			r.err = err
+			return false, err
+		}
+		r.fans = fans
 	}
 
-	speed, err := readSpeed(r.fanPath)
-	if err != nil {
-		r.err = fmt.Errorf("error reading speed")
-		return true, err
+	for i := range r.fans {
+		speed, err := readSpeed(r.fans[i].input)
+		if err != nil {
+			r.err = fmt.Errorf("error reading speed")
+			return true, err
+		}
+		r.fans[i].speed = speed
+
+		r.fans[i].duty = -1
+		if r.pwm && r.fans[i].pwmFile != "" {
+			if duty, err := readSpeed(r.fans[i].pwmFile); err == nil {
+				r.fans[i].duty = (duty * 100) / 255
+			}
+		}
 	}
 
-	r.speed = speed
 	return true, nil
 }
 
-// String prints the current speed in RPM.
+// String prints the current speed of each fan in RPM (or as a percentage of its maximum speed).
 func (r *Routine) String() string {
 	if r == nil {
 		return "bad routine"
@@ -98,9 +156,12 @@ func (r *Routine) String() string {
 
 	var c string
 
-	perc := (r.speed * 100) / r.max
-	if perc > 100 {
-		perc = 100
+	// Color by the fan that is closest to its maximum speed.
+	perc := 0
+	for _, fan := range r.fans {
+		if p := fan.perc(); p > perc {
+			perc = p
+		}
 	}
 
 	if perc < 75 {
@@ -111,7 +172,38 @@ func (r *Routine) String() string {
 		c = r.colors.error
 	}
 
-	return fmt.Sprintf("%s%v RPM%s", c, r.speed, colorEnd)
+	speeds := make([]string, len(r.fans))
+	for i, fan := range r.fans {
+		switch {
+		case !r.percent:
+			speeds[i] = strconv.Itoa(fan.speed)
+		case fan.max > 0:
+			speeds[i] = fmt.Sprintf("%v%%", fan.perc())
+		default:
+			speeds[i] = fmt.Sprintf("%vRPM", fan.speed)
+		}
+	}
+
+	s := strings.Join(speeds, "/")
+	if r.percent {
+		s += " FAN"
+	} else {
+		s += " RPM"
+	}
+
+	if r.pwm {
+		duties := make([]string, len(r.fans))
+		for i, fan := range r.fans {
+			if fan.duty < 0 {
+				duties[i] = "-"
+			} else {
+				duties[i] = fmt.Sprintf("%v%%", fan.duty)
+			}
+		}
+		s += " PWM " + strings.Join(duties, "/")
+	}
+
+	return c + s + colorEnd
 }
 
 // Error formats and returns an error message.
@@ -132,49 +224,102 @@ func (r *Routine) Name() string {
 	return "Fan"
 }
 
-// findFiles finds the files that we'll monitor for the fan speed. It will be in one of the hardware
-// device directories in /sys/class/hwmon.
-func findFiles() (string, string, error) {
-	// Get all the device directories in the main directory.
-	dirs, err := ioutil.ReadDir(baseDir)
-	if err != nil {
-		return "", "", err
+// perc calculates the fan's speed as a percentage of its maximum speed, or 0 if the maximum speed
+// isn't known.
+func (f fan) perc() int {
+	if f.max <= 0 {
+		return 0
 	}
 
-	// Search in each device directory to find the fan.
-	for _, dir := range dirs {
-		path := filepath.Join(baseDir, dir.Name(), "/device/")
-		files, err := ioutil.ReadDir(path)
-		if err != nil {
-			return "", "", err
+	perc := (f.speed * 100) / f.max
+	if perc > 100 {
+		perc = 100
+	}
+
+	return perc
+}
+
+// findFans finds the fans to show. If fans were chosen with SetFans, then only those are returned,
+// in the order that they were chosen.
+func (r *Routine) findFans() ([]fan, error) {
+	all := allFans()
+	if len(all) == 0 {
+		return nil, fmt.Errorf("no fan file")
+	}
+
+	if len(r.labels) == 0 {
+		return all, nil
+	}
+
+	var fans []fan
+	for _, name := range r.labels {
+		chip, label := "", name
+		if i := strings.Index(name, ":"); i >= 0 {
+			chip, label = name[:i], name[i+1:]
+		}
+
+		for _, f := range all {
+			if chip != "" && !strings.EqualFold(f.chip, chip) {
+				continue
+			}
+			if strings.EqualFold(f.label, label) {
+				fans = append(fans, f)
+			}
 		}
+	}
+
+	if len(fans) == 0 {
+		return nil, fmt.Errorf("no matching fans")
+	}
+
+	return fans, nil
+}
+
+// allFans finds every fan in every hardware device directory in /sys/class/hwmon. Older kernels
+// keep the files in the device's "device" directory. Some devices only report the speed that the
+// fan is being driven at (in "fan*_output") instead of the measured speed (in "fan*_input").
+func allFans() []fan {
+	dirs, _ := filepath.Glob(filepath.Join(hwmonDir, "hwmon*"))
+	sort.Strings(dirs)
+
+	var fans []fan
+	for _, dir := range dirs {
+		chip := readString(filepath.Join(dir, "name"))
+		for _, path := range []string{dir, filepath.Join(dir, "device")} {
+			inputs, _ := filepath.Glob(filepath.Join(path, "fan[0-9]*_input"))
+			if len(inputs) == 0 {
+				inputs, _ = filepath.Glob(filepath.Join(path, "fan[0-9]*_output"))
+			}
+			if len(inputs) == 0 {
+				continue
+			}
+			sort.Strings(inputs)
+
+			for _, input := range inputs {
+				prefix := input[:strings.LastIndex(input, "_")]
+				name := filepath.Base(prefix)
 
-		// Find the first file that has a name match. The files we want will start with "fan" and
-		// end with "max" or "output".
-		prefix := "fan"
-		maxFilename := "" // File that contains the maximum speed of the fan, in RPM.
-		outFilename := "" // File that contains the current speed of the fan, in RPM.
-		for _, file := range files {
-			filename := file.Name()
-			if strings.HasPrefix(filename, prefix) {
-				if strings.HasSuffix(filename, "max") {
-					maxFilename = filepath.Join(path, filename)
-					prefix = strings.TrimSuffix(filename, "max")
-				} else if strings.HasSuffix(filename, "output") {
-					outFilename = filepath.Join(path, filename)
-					prefix = strings.TrimSuffix(prefix, "output")
+				f := fan{chip: chip, label: readString(prefix + "_label"), input: input}
+				if f.label == "" {
+					f.label = name
+				}
+				if max, err := readSpeed(prefix + "_max"); err == nil {
+					f.max = max
 				}
 
-				// If we've found both files, we can stop looking.
-				if maxFilename != "" && outFilename != "" {
-					return maxFilename, outFilename, nil
+				// The fan's PWM control has the same number as the fan, e.g. "pwm2" for "fan2".
+				pwmFile := filepath.Join(path, "pwm"+strings.TrimPrefix(name, "fan"))
+				if readString(pwmFile) != "" {
+					f.pwmFile = pwmFile
 				}
+
+				fans = append(fans, f)
 			}
+			break
 		}
 	}
 
-	// If we made it here, then we didn't find anything.
-	return "", "", fmt.Errorf("no fan file")
+	return fans
 }
 
 // readSpeed reads the value of the provided file. The value will be a speed in RPM.
@@ -186,3 +331,14 @@ func readSpeed(path string) (int, error) {
 
 	return strconv.Atoi(strings.TrimSpace(string(b)))
 }
+
+// readString reads out the contents of the file at the provided path, or an empty string if it
+// can't be read.
+func readString(path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(b))
+}
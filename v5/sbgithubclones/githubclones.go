@@ -141,6 +141,39 @@ func (r *Routine) Name() string {
 	return "Github Clone Count"
 }
 
+// savedData is the routine's data that is saved across restarts.
+type savedData struct {
+	Day  string `json:"day"`
+	Week string `json:"week"`
+}
+
+// Save returns the current clone counts so they can be shown after a restart until the next
+// successful update.
+func (r *Routine) Save() ([]byte, error) {
+	if r == nil {
+		return nil, fmt.Errorf("bad routine")
+	}
+
+	return json.Marshal(savedData{Day: r.dayCount, Week: r.weekCount})
+}
+
+// Restore loads the clone counts previously returned by Save.
+func (r *Routine) Restore(data []byte) error {
+	if r == nil {
+		return fmt.Errorf("bad routine")
+	}
+
+	saved := savedData{}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	r.dayCount = saved.Day
+	r.weekCount = saved.Week
+
+	return nil
+}
+
 // buildRequest builds the request that will be used to get either the daily or weekly clone counts.
 func buildRequest(owner, repo, authUser, authToken string, daily bool) (*http.Request, error) {
 	// Set up the query.
@@ -116,3 +116,16 @@ func (r *Routine) Error() string {
 func (r *Routine) Name() string {
 	return "Load"
 }
+
+// Metrics returns the 3 load averages.
+func (r *Routine) Metrics() map[string]float64 {
+	if r == nil {
+		return nil
+	}
+
+	return map[string]float64{
+		"load1":  r.load1,
+		"load5":  r.load5,
+		"load15": r.load15,
+	}
+}
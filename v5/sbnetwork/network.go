@@ -8,6 +8,8 @@ import (
 	"net"
 	"strconv"
 	"strings"
+
+	"github.com/snhilde/statusbar/v5/graph"
 )
 
 var colorEnd = "^d^"
@@ -27,6 +29,10 @@ type Routine struct {
 	// Cache of data for every interface monitored.
 	cache map[string]sbiface
 
+	// Number of samples to show in each interface's graph, as set with ShowGraph. If this is 0,
+	// then the graphs are not shown.
+	graphLen int
+
 	// Trio of user-provided colors for displaying various states.
 	colors struct {
 		normal  string
@@ -51,6 +57,9 @@ type sbiface struct {
 
 	// Current reading of tx_bytes file.
 	newUp int
+
+	// Recent total (received and sent) byte counts per update, for drawing the graph.
+	history *graph.Ring
 }
 
 // New returns a new routine object populated with either the given interfaces or the active ones if
@@ -126,6 +135,16 @@ func (r *Routine) Update() (bool, error) {
 		}
 		iface.newUp = up
 
+		// Record the total throughput for the graph. We need a previous reading to do this.
+		if r.graphLen > 0 {
+			if iface.history == nil {
+				iface.history = graph.NewRing(r.graphLen)
+			}
+			if iface.oldDown > 0 || iface.oldUp > 0 {
+				iface.history.Push(float64((iface.newDown - iface.oldDown) + (iface.newUp - iface.oldUp)))
+			}
+		}
+
 		iface.enabled = true
 		r.cache[iname] = iface
 	}
@@ -165,6 +184,9 @@ func (r *Routine) String() string {
 
 			b.WriteString(c)
 			fmt.Fprintf(&b, "%v: %4v%c↓|%4v%c↑", iname, down, downUnit, up, upUnit)
+			if r.graphLen > 0 && iface.history.Len() > 0 {
+				b.WriteString(" " + graph.Sparkline(iface.history.Values(), 0, 0))
+			}
 			b.WriteString(colorEnd)
 		} else {
 			b.WriteString(r.colors.error)
@@ -194,6 +216,32 @@ func (r *Routine) Name() string {
 	return "Network"
 }
 
+// Metrics returns the number of bytes received and sent since the last update for each interface
+// that is currently up. The keys are the interface name followed by "_down" or "_up".
+func (r *Routine) Metrics() map[string]float64 {
+	if r == nil {
+		return nil
+	}
+
+	metrics := make(map[string]float64)
+	for _, iname := range r.printNames {
+		if iface, ok := r.cache[iname]; ok && iface.enabled {
+			metrics[iname+"_down"] = float64(iface.newDown - iface.oldDown)
+			metrics[iname+"_up"] = float64(iface.newUp - iface.oldUp)
+		}
+	}
+
+	return metrics
+}
+
+// ShowGraph displays a sparkline of the total throughput over the last samples updates after each
+// interface's current throughput. The sparkline is scaled to the busiest update shown.
+func (r *Routine) ShowGraph(samples int) {
+	if r != nil && samples > 0 {
+		r.graphLen = samples
+	}
+}
+
 // findInterfaces finds all network interfaces that are currently active.
 func findInterfaces() ([]string, error) {
 	ifaces, err := net.Interfaces()
@@ -30,6 +30,10 @@ type Routine struct {
 	// Unit of used memory.
 	usedUnit rune
 
+	// Total and used memory, in KiB, as read from /proc/meminfo.
+	totalKiB int
+	usedKiB  int
+
 	// Trio of user-provided colors for displaying various states.
 	colors struct {
 		normal  string
@@ -87,6 +91,8 @@ func (r *Routine) Update() (bool, error) {
 	}
 
 	r.perc = (total - avail) * 100 / total
+	r.totalKiB = total
+	r.usedKiB = total - avail
 	r.total, r.totalUnit = shrink(total)
 	r.used, r.usedUnit = shrink(total - avail)
 
@@ -130,6 +136,19 @@ func (r *Routine) Name() string {
 	return "RAM"
 }
 
+// Metrics returns the used and total system memory, in bytes, and the percentage of memory in use.
+func (r *Routine) Metrics() map[string]float64 {
+	if r == nil {
+		return nil
+	}
+
+	return map[string]float64{
+		"used":  float64(r.usedKiB) * 1024,
+		"total": float64(r.totalKiB) * 1024,
+		"usage": float64(r.perc),
+	}
+}
+
 // parseFile parses the meminfo file.
 func parseFile(output string) (int, int, error) {
 	var total int
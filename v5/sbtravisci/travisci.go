@@ -119,18 +119,12 @@ func (r *Routine) String() string {
 		return "bad routine"
 	}
 
-	// Figure out which color and timestamp we need to use for this state.
+	// Figure out which color we need to use for this state.
 	var color string
-	switch r.build.State {
-	case "created":
-		color = r.colors.normal
-	case "started":
-		color = r.colors.normal
-	case "passed":
+	switch r.State() {
+	case "normal":
 		color = r.colors.normal
-	case "failed":
-		color = r.colors.warning
-	case "canceled":
+	case "warning":
 		color = r.colors.warning
 	default:
 		color = r.colors.error
@@ -157,6 +151,23 @@ func (r *Routine) Name() string {
 	return "Travis CI Build Status"
 }
 
+// State returns "normal" for enqueued/passing builds, "warning" for canceled/failed builds, and
+// "error" for everything else, following the same rules used for colorizing the output.
+func (r *Routine) State() string {
+	if r == nil {
+		return "error"
+	}
+
+	switch r.build.State {
+	case "created", "started", "passed":
+		return "normal"
+	case "failed", "canceled":
+		return "warning"
+	}
+
+	return "error"
+}
+
 // getBuild gets the latest build.
 func (r *Routine) getBuild() (build, error) {
 	type Response struct {
@@ -2,10 +2,15 @@
 package sbvolume
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os/exec"
 	"strconv"
 	"strings"
+
+	"github.com/snhilde/statusbar/v5/restapi"
 )
 
 var colorEnd = "^d^"
@@ -141,3 +146,120 @@ func (r *Routine) Error() string {
 func (r *Routine) Name() string {
 	return "Volume"
 }
+
+// Endpoints returns the REST API endpoints for changing the volume and mute status, which the
+// statusbar engine mounts under this routine.
+func (r *Routine) Endpoints() (restapi.RestSpec, interface{}) {
+	spec := restapi.RestSpec{
+		Tables: []restapi.Table{
+			{
+				Name: "volume",
+				Endpoints: []restapi.Endpoint{
+					{
+						Method: "PUT",
+						URL:    "/volume",
+						Desc:   "Set the volume, as a percentage of max.",
+						Request: map[string]interface{}{
+							"volume": map[string]interface{}{"type": "integer", "description": "New volume, from 0 to 100"},
+						},
+						Callback: "HandlePutVolume",
+					},
+					{
+						Method: "PUT",
+						URL:    "/mute",
+						Desc:   "Mute or unmute the volume.",
+						Request: map[string]interface{}{
+							"muted": map[string]interface{}{"type": "boolean", "description": "Whether or not the volume should be muted"},
+						},
+						Callback: "HandlePutMute",
+					},
+				},
+			},
+		},
+	}
+
+	return spec, apiHandler{r.control}
+}
+
+// apiHandler holds the callbacks for this routine's REST API endpoints. The callbacks only change the
+// mixer, and the engine updates the routine afterward, so they don't touch the routine itself.
+type apiHandler struct {
+	// Control to change.
+	control string
+}
+
+// HandlePutVolume sets the control's volume.
+// endpoint: PUT /volume
+func (a apiHandler) HandlePutVolume(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
+	body := struct {
+		Volume *int `json:"volume"`
+	}{}
+	if code, output := decodeBody(request, &body); code != 0 {
+		return code, output
+	}
+
+	if body.Volume == nil || *body.Volume < 0 || *body.Volume > 100 {
+		return encodeError(400, "invalid_value", "volume must be from 0 to 100")
+	}
+
+	return a.set(strconv.Itoa(*body.Volume) + "%")
+}
+
+// HandlePutMute mutes or unmutes the control.
+// endpoint: PUT /mute
+func (a apiHandler) HandlePutMute(endpoint restapi.Endpoint, params restapi.Params, request *http.Request) (int, string) {
+	body := struct {
+		Muted *bool `json:"muted"`
+	}{}
+	if code, output := decodeBody(request, &body); code != 0 {
+		return code, output
+	}
+
+	if body.Muted == nil {
+		return encodeError(400, "invalid_value", "missing muted")
+	}
+
+	if *body.Muted {
+		return a.set("mute")
+	}
+	return a.set("unmute")
+}
+
+// set runs 'amixer set' on the control with the value.
+func (a apiHandler) set(value string) (int, string) {
+	if a.control == "" {
+		return encodeError(500, "internal_error", "invalid control")
+	}
+
+	if err := exec.Command("amixer", "set", a.control, value).Run(); err != nil {
+		return encodeError(500, "internal_error", "error setting volume")
+	}
+
+	return 204, ""
+}
+
+// decodeBody reads the request's JSON body into v. If that fails, then this returns the HTTP
+// response code and error response. Otherwise, the code is 0.
+func decodeBody(request *http.Request, v interface{}) (int, string) {
+	b, err := ioutil.ReadAll(request.Body)
+	if err != nil || len(b) == 0 {
+		return encodeError(400, "invalid_request", "missing request body")
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return encodeError(400, "invalid_request", err.Error())
+	}
+
+	return 0, ""
+}
+
+// encodeError builds an error response with the HTTP status code. The body has the same shape as
+// the statusbar's own v2 errors, with a human-readable message and a machine-readable code.
+func encodeError(status int, code string, msg string) (int, string) {
+	b, _ := json.Marshal(struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}{msg, code})
+
+	return status, string(b)
+}
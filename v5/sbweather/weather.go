@@ -228,6 +228,41 @@ func (r *Routine) Name() string {
 	return "Weather"
 }
 
+// savedData is the routine's data that is saved across restarts.
+type savedData struct {
+	Curr float32 `json:"current"`
+	High float32 `json:"high"`
+	Low  float32 `json:"low"`
+}
+
+// Save returns the current temperature and forecast so they can be shown after a restart until the
+// next successful update.
+func (r *Routine) Save() ([]byte, error) {
+	if r == nil {
+		return nil, fmt.Errorf("bad routine")
+	}
+
+	return json.Marshal(savedData{Curr: r.currTemp, High: r.highTemp, Low: r.lowTemp})
+}
+
+// Restore loads the temperature and forecast previously returned by Save.
+func (r *Routine) Restore(data []byte) error {
+	if r == nil {
+		return fmt.Errorf("bad routine")
+	}
+
+	saved := savedData{}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	r.currTemp = saved.Curr
+	r.highTemp = saved.High
+	r.lowTemp = saved.Low
+
+	return nil
+}
+
 // getWeather gets the current weather data from OpenWeather.
 func getWeather(client *http.Client, request *http.Request) (weather, error) {
 	resp, err := client.Do(request)
@@ -0,0 +1,168 @@
+// This file contains the parser for cron expressions.
+
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How far ahead we'll search for a matching time before giving up on a cron expression.
+const cronSearchLimit = 5
+
+// cron runs according to a standard 5-field cron expression: minute, hour, day of month, month, and
+// day of week. Each field is stored as a bitset of the values it matches.
+type cron struct {
+	// Original spec, for printing.
+	spec string
+
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	// Whether or not the day-of-month and day-of-week fields were left unrestricted. Following the
+	// usual cron rules, if both fields are restricted, then a day matches if either field does.
+	domAny bool
+	dowAny bool
+}
+
+// parseCron parses a 5-field cron expression. Each field can be "*", a number, a range ("1-5"), a
+// list ("1,3,5"), or any of these with a step ("*/15" or "0-30/10"). For the day of week, both 0 and
+// 7 mean Sunday.
+func parseCron(spec string) (cron, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return cron{}, fmt.Errorf("cron expression needs 5 fields, found %d", len(fields))
+	}
+
+	c := cron{spec: spec}
+	var err error
+
+	if c.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return cron{}, fmt.Errorf("minute: %w", err)
+	}
+	if c.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return cron{}, fmt.Errorf("hour: %w", err)
+	}
+	if c.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return cron{}, fmt.Errorf("day of month: %w", err)
+	}
+	if c.month, err = parseField(fields[3], 1, 12); err != nil {
+		return cron{}, fmt.Errorf("month: %w", err)
+	}
+	if c.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return cron{}, fmt.Errorf("day of week: %w", err)
+	}
+
+	// Fold 7 (Sunday) into 0.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	// A stepped wildcard like "*/2" still leaves the field unrestricted for these rules.
+	c.domAny = strings.HasPrefix(fields[2], "*")
+	c.dowAny = strings.HasPrefix(fields[4], "*")
+
+	return c, nil
+}
+
+// parseField parses a single field of a cron expression into a bitset of the values it matches.
+// first and last are the bounds of the field.
+func parseField(field string, first, last int) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		// Pull off the step, if there is one.
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+			part = part[:i]
+		}
+
+		// Figure out the range of values.
+		low, high := first, last
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err1, err2 error
+			low, err1 = strconv.Atoi(bounds[0])
+			high, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			low, high = n, n
+			if step > 1 {
+				// "5/10" means starting at 5, every 10.
+				high = last
+			}
+		}
+
+		if low < first || high > last || low > high {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, first, last)
+		}
+
+		for i := low; i <= high; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits, nil
+}
+
+// Next returns the first time after t that matches the cron expression. If nothing matches within
+// the next 5 years (e.g. "0 0 31 2 *"), then this returns the zero time.
+func (c cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+
+	// Cron runs at the top of the minute, so start with the next whole minute.
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+	limit := t.AddDate(cronSearchLimit, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// String returns the spec for the schedule.
+func (c cron) String() string {
+	return c.spec
+}
+
+// dayMatches checks whether or not the day of t matches the day-of-month and day-of-week fields.
+func (c cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+
+	return dom || dow
+}
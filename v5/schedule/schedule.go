@@ -0,0 +1,244 @@
+// Package schedule determines when routines should run.
+//
+// By default, the statusbar engine runs each routine on a fixed interval measured from when its
+// last update started. A Schedule gives finer control over this. Schedules are built from a spec
+// string with Parse, which accepts these forms:
+//	@every 30s          Run every 30 seconds, measured from the last update (the default behavior).
+//	@aligned 15m        Run on every multiple of 15 minutes on the wall clock (:00, :15, :30, :45).
+//	*/15 7-19 * * 1-5   Run according to a standard 5-field cron expression.
+//	@daily              Cron shorthand. @hourly, @daily, @midnight, @weekly, @monthly, and @yearly
+//	                    are supported.
+// Any of the above can be followed by "while <condition>", e.g. "@aligned 1m while ac_power". The
+// routine then only runs when the condition is met. See Conditions for the list of conditions.
+package schedule
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Schedule is the interface that describes when a routine should run.
+type Schedule interface {
+	// Next returns the next time after t that the routine should run. If the routine should never
+	// run again, then Next returns the zero time.
+	Next(t time.Time) time.Time
+
+	// String returns the spec for the schedule, in the form accepted by Parse.
+	String() string
+}
+
+// Conditions are the conditions that can be used in a schedule's "while" clause, keyed by name. To
+// make a custom condition available, add it to this map before parsing any schedules that use it.
+var Conditions = map[string]func() bool{
+	"ac_power": OnACPower,
+	"battery":  OnBattery,
+}
+
+// Cron shorthands and the expressions they stand for.
+var shorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// every runs on a fixed interval.
+type every struct {
+	interval time.Duration
+}
+
+// aligned runs on multiples of an interval on the wall clock.
+type aligned struct {
+	interval time.Duration
+}
+
+// conditional runs on its schedule only while its condition is met.
+type conditional struct {
+	Schedule
+
+	// Name of the condition, as found in Conditions.
+	name string
+
+	// Function that checks whether or not the condition is met.
+	check func() bool
+}
+
+// Parse parses the spec and returns the schedule it describes. See the package documentation for
+// the accepted formats.
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	// Pull off the condition, if there is one.
+	condition := ""
+	if i := strings.Index(spec, " while "); i >= 0 {
+		condition = strings.TrimSpace(spec[i+len(" while "):])
+		spec = strings.TrimSpace(spec[:i])
+	}
+
+	s, err := parseSchedule(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if condition == "" {
+		return s, nil
+	}
+
+	check, ok := Conditions[condition]
+	if !ok {
+		return nil, fmt.Errorf("unknown condition: %s", condition)
+	}
+
+	return conditional{s, condition, check}, nil
+}
+
+// Every returns a schedule that runs every interval, measured from the start of the previous run.
+func Every(interval time.Duration) Schedule {
+	return every{interval}
+}
+
+// Aligned returns a schedule that runs on every multiple of interval on the local wall clock. For
+// example, an interval of 15 minutes runs at the top of the hour, quarter past, half past, and
+// quarter to.
+func Aligned(interval time.Duration) Schedule {
+	return aligned{interval}
+}
+
+// Allowed reports whether or not a routine running on s may update now. This is always true unless
+// s has a condition that is not currently met. A nil Schedule is always allowed.
+func Allowed(s Schedule) bool {
+	if c, ok := s.(conditional); ok {
+		return c.check()
+	}
+
+	return true
+}
+
+// OnACPower checks whether or not the system is running on AC power. If the system does not report
+// any AC adapters (like most desktops), then it is always considered to be on AC power.
+func OnACPower() bool {
+	supplies, err := filepath.Glob("/sys/class/power_supply/*")
+	if err != nil {
+		return true
+	}
+
+	found := false
+	for _, supply := range supplies {
+		b, err := ioutil.ReadFile(filepath.Join(supply, "type"))
+		if err != nil || strings.TrimSpace(string(b)) != "Mains" {
+			continue
+		}
+		found = true
+
+		online, err := ioutil.ReadFile(filepath.Join(supply, "online"))
+		if err == nil && strings.TrimSpace(string(online)) == "1" {
+			return true
+		}
+	}
+
+	return !found
+}
+
+// OnBattery checks whether or not the system is running on battery power. This is the opposite of
+// OnACPower.
+func OnBattery() bool {
+	return !OnACPower()
+}
+
+// parseSchedule parses a spec that does not have a condition.
+func parseSchedule(spec string) (Schedule, error) {
+	if expr, ok := shorthands[spec]; ok {
+		c, err := parseCron(expr)
+		if err != nil {
+			return nil, err
+		}
+		c.spec = spec
+		return c, nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty schedule")
+	}
+
+	switch fields[0] {
+	case "@every", "@aligned":
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s needs exactly one duration", fields[0])
+		}
+
+		d, err := time.ParseDuration(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("duration must be at least 1 second")
+		}
+
+		if fields[0] == "@every" {
+			return Every(d), nil
+		}
+		return Aligned(d), nil
+	}
+
+	if strings.HasPrefix(spec, "@") {
+		return nil, fmt.Errorf("unknown schedule: %s", fields[0])
+	}
+
+	c, err := parseCron(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Next returns the time one interval after t.
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(e.interval)
+}
+
+// String returns the spec for the schedule.
+func (e every) String() string {
+	return "@every " + formatDuration(e.interval)
+}
+
+// Next returns the next multiple of the interval after t on the local wall clock.
+func (a aligned) Next(t time.Time) time.Time {
+	// time.Truncate works on absolute time, so we need to shift into local time first to line the
+	// intervals up with the wall clock.
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+
+	return t.Add(shift).Truncate(a.interval).Add(a.interval).Add(-shift)
+}
+
+// String returns the spec for the schedule.
+func (a aligned) String() string {
+	return "@aligned " + formatDuration(a.interval)
+}
+
+// String returns the spec for the schedule, including the condition.
+func (c conditional) String() string {
+	return c.Schedule.String() + " while " + c.name
+}
+
+// formatDuration formats d like time.Duration's String method, but without any trailing zero units
+// (e.g. "15m" instead of "15m0s").
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+
+	return s
+}
@@ -0,0 +1,104 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/snhilde/statusbar/v5/schedule"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	valid := []string{
+		"@every 30s",
+		"@aligned 15m",
+		"@daily",
+		"*/15 7-19 * * 1-5",
+		"0 7 * * *",
+		"0,30 * 1 1-6/2 7",
+		"@aligned 1m while ac_power",
+	}
+	for _, spec := range valid {
+		s, err := schedule.Parse(spec)
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error: %s", spec, err)
+			continue
+		}
+		if s.String() != spec {
+			t.Errorf("Parse(%q): String() returned %q", spec, s.String())
+		}
+	}
+
+	invalid := []string{
+		"",
+		"@every",
+		"@every 100ms",
+		"@sometimes",
+		"* * * *",
+		"60 * * * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"@daily while asleep",
+	}
+	for _, spec := range invalid {
+		if _, err := schedule.Parse(spec); err == nil {
+			t.Errorf("Parse(%q): expected error", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	t.Parallel()
+
+	// Wednesday, January 6, 2021.
+	start := time.Date(2021, time.January, 6, 10, 7, 42, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"@every 90s", start.Add(90 * time.Second)},
+		{"@aligned 1m", time.Date(2021, time.January, 6, 10, 8, 0, 0, time.UTC)},
+		{"@aligned 15m", time.Date(2021, time.January, 6, 10, 15, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2021, time.January, 6, 11, 0, 0, 0, time.UTC)},
+		{"0 7 * * *", time.Date(2021, time.January, 7, 7, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2021, time.January, 6, 10, 15, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2021, time.January, 7, 9, 30, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2021, time.January, 10, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2021, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2021, time.January, 8, 0, 0, 0, 0, time.UTC)},
+		{"0 0 */2 * 1", time.Date(2021, time.January, 11, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+
+	for _, test := range tests {
+		s, err := schedule.Parse(test.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %s", test.spec, err)
+			continue
+		}
+		if got := s.Next(start); !got.Equal(test.want) {
+			t.Errorf("%q: got %v, want %v", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	t.Parallel()
+
+	schedule.Conditions["never"] = func() bool { return false }
+
+	s, err := schedule.Parse("@every 1m while never")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schedule.Allowed(s) {
+		t.Errorf("conditional schedule should not be allowed")
+	}
+
+	if !schedule.Allowed(schedule.Every(time.Minute)) || !schedule.Allowed(nil) {
+		t.Errorf("unconditional schedule should be allowed")
+	}
+}
@@ -8,17 +8,24 @@ package statusbar
 import "C"
 
 import (
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
+	"unicode/utf8"
 	"unsafe"
 
+	"github.com/snhilde/statusbar/v5/alert"
 	"github.com/snhilde/statusbar/v5/apispecs"
 	"github.com/snhilde/statusbar/v5/restapi"
+	"github.com/snhilde/statusbar/v5/schedule"
 )
 
 // RoutineHandler allows information monitors (commonly called routines) to be linked in.
@@ -47,29 +54,125 @@ type RoutineHandler interface {
 	Name() string
 }
 
+// These are the states that a routine can be in. A routine can report StateNormal, StateWarning, or
+// StateError itself by implementing StateReporter. The engine reports StateFailed when the routine's
+// Update returns an error and StateStopped when the routine is no longer running.
+const (
+	StateNormal  = "normal"
+	StateWarning = "warning"
+	StateError   = "error"
+	StateFailed  = "failed"
+	StateStopped = "stopped"
+)
+
+// StateReporter is an optional interface that a RoutineHandler can implement to report the state of
+// its current output. State should return StateNormal, StateWarning, or StateError, which typically
+// match the normal, warning, and error colors that the routine uses for its output. If a routine
+// does not implement this, then it is always in StateNormal while it is updating successfully.
+type StateReporter interface {
+	State() string
+}
+
+// MetricsReporter is an optional interface that a RoutineHandler can implement to expose its
+// numeric data. If a routine implements this, then the engine records the metrics after every
+// successful run of Update and keeps a bounded history of them, which is available through the
+// APIs.
+type MetricsReporter interface {
+	// Metrics returns the routine's current numeric data, keyed by the metric's name.
+	Metrics() map[string]float64
+}
+
+// Persister is an optional interface that a RoutineHandler can implement to keep its data across
+// restarts. If the state store is enabled with EnableStateStore, then the engine periodically saves
+// the routine's data and last good output to disk. When the statusbar starts up again, the engine
+// restores the data and shows the saved output, marked as stale, until the routine's first update
+// finishes.
+type Persister interface {
+	// Save returns the routine's current data in a form that Restore can read back in.
+	Save() ([]byte, error)
+
+	// Restore loads data that was previously returned by Save.
+	Restore([]byte) error
+}
+
+// EndpointProvider is an optional interface that a RoutineHandler can implement to add its own
+// endpoints to the REST API, such as controls for the routine. The endpoints are mounted under the
+// routine in each version of the API, i.e. "/rest/v1/routines/<module name>/..." and
+// "/rest/v2/routines/<routine ID>/...". Because v1 goes by module name, only the first routine of
+// each module gets its endpoints there. After a successful request to one of the routine's
+// endpoints that isn't a GET, the routine is updated so that the bar shows the change right away.
+type EndpointProvider interface {
+	// Endpoints returns the specification of the routine's endpoints and the object that implements
+	// their callbacks. See the restapi package for how to build these. Only the specification's
+	// tables are used. The callbacks are called from the API's goroutines, so they must be safe to
+	// run alongside Update.
+	Endpoints() (restapi.RestSpec, interface{})
+}
+
 // Statusbar is the main type for this package. It holds information about the bar as a whole.
 type Statusbar struct {
-	// List of routines, in the order they were added.
+	// List of routines, in the order they are displayed. This is replaced (never changed in place) when
+	// routines are moved, so a copy of the slice can be safely iterated over.
 	routines []*routine
 
+	// Protects the list of routines and the count of live routines once the statusbar is running.
+	mutex sync.Mutex
+
 	// Delimiter to use for the left side of each routine's output, as set with SetMarkers.
 	leftDelim string
 
 	// Delimiter to use for the right side of each routine's output, as set with SetMarkers.
 	rightDelim string
 
-	// Index of the routine after which the routines are split, as set with Split.
-	split int
+	// Whether or not Split has been called. Routines added after this are displayed on the
+	// secondary bar.
+	splitting bool
+
+	// Channel that routines send themselves on when they stop.
+	finished chan *routine
+
+	// Number of routines that are running.
+	live int
 
 	// Timer that is started when the statusbar is started. This is used to measure the statusbar's uptime.
 	startTime time.Time
 
+	// Number of metric samples to keep in each routine's history, as set with SetHistorySize.
+	historySize int
+
 	// The port to run the REST API on. If this is 0, the engine does not run.
 	restPort int
 
+	// Host or IP address to run the REST API on, as set with SetRESTAddress. If this is empty, the
+	// engine listens on the loopback interface.
+	restHost string
+
+	// Tokens that grant access to the REST API, as added with AddRESTToken and AddRESTTokenFile.
+	restTokens []restToken
+
+	// Path of the Unix socket to run the REST API on, as set with EnableRESTSocket. If this is
+	// empty, the engine does not listen on a socket.
+	restSocket string
+
+	// Certificate and key files for serving the REST API over HTTPS, as set with EnableRESTTLS.
+	restCert string
+	restKey  string
+
 	// REST API engine.
 	restEngine *restapi.Engine
 
+	// Dispatcher for sending alerts when routines change state, as set up with AddAlert.
+	alerts *alert.Dispatcher
+
+	// Store for saving routines' state across restarts, as set up with EnableStateStore.
+	store *stateStore
+
+	// How old output is handled and marked, as set with SetStaleness and SetStaleStyle.
+	stale staleness
+
+	// Feed of the bar's frames and routines' state changes.
+	feed *feed
+
 	// Whether or not the engine is currently running. This is toggled on and off by calls to Run and Stop.
 	running bool
 }
@@ -80,10 +183,52 @@ var (
 	root = C.XDefaultRootWindow(dpy)
 )
 
+// restToken is a bearer token for the REST API and the access it grants.
+type restToken struct {
+	value string
+	scope restapi.Scope
+}
+
+// staleness holds the settings for handling old output.
+type staleness struct {
+	// How long after a routine's last successful update its output is considered stale. If this is
+	// 0, then output does not go stale with time alone.
+	age time.Duration
+
+	// Whether or not to keep showing a routine's last good output (marked as stale) when its update
+	// fails, instead of its error message.
+	keep bool
+
+	// Marker to show before stale output.
+	marker string
+
+	// Color code to replace stale output's own colors with, if set.
+	color string
+}
+
+// mark returns the output marked as stale.
+func (s staleness) mark(output string) string {
+	if s.color != "" {
+		output = s.color + colorCodes.ReplaceAllString(output, "") + "^d^"
+	}
+
+	return s.marker + output
+}
+
+// defaultHistorySize is the number of metric samples kept for each routine if SetHistorySize is not
+// called.
+const defaultHistorySize = 60
+
 // New creates a new statusbar. The default delimiters around each routine are square brackets ('['
 // and ']'), which can be changed with SetMarkers.
 func New() Statusbar {
-	return Statusbar{leftDelim: "[", rightDelim: "]", split: -1}
+	return Statusbar{
+		leftDelim:   "[",
+		rightDelim:  "]",
+		historySize: defaultHistorySize,
+		stale:       staleness{marker: "~"},
+		feed:        newFeed(),
+	}
 }
 
 // Append adds a routine to the statusbar's internal list of routines. Routines are displayed in
@@ -108,9 +253,42 @@ func (sb *Statusbar) Append(handler RoutineHandler, seconds int) {
 		log.Printf("Failed to determine package name (%s)", refType)
 	}
 
+	// Give the routine a unique ID, based on its module name.
+	r.id = r.moduleName()
+	for n := 2; sb.findRoutine(r.id) != nil; n++ {
+		r.id = fmt.Sprintf("%s-%d", r.moduleName(), n)
+	}
+
+	if sb.splitting {
+		r.setBar(regionSecondary)
+	}
+
 	sb.routines = append(sb.routines, r)
 }
 
+// AppendScheduled adds a routine to the statusbar like Append, but the routine runs according to the
+// schedule described by spec instead of on a fixed interval. For example, "@aligned 1m" runs the
+// routine at the top of every minute, "0 7 * * *" runs it every day at 07:00, and "@every 10s while
+// ac_power" runs it every 10 seconds but only while the system is on AC power. See the schedule
+// package for all accepted formats. seconds is the routine's interval, which is used to figure out
+// how long to wait after an error and to run the routine if its schedule is cleared through the
+// REST API. This returns an error if spec is not valid or seconds is less than 1.
+func (sb *Statusbar) AppendScheduled(handler RoutineHandler, spec string, seconds int) error {
+	sched, err := schedule.Parse(spec)
+	if err != nil {
+		return err
+	}
+
+	if seconds < 1 {
+		return fmt.Errorf("interval must be at least 1 second")
+	}
+
+	sb.Append(handler, seconds)
+	sb.routines[len(sb.routines)-1].setSchedule(sched)
+
+	return nil
+}
+
 // Run spins up all the routines and displays them on the statusbar. If the APIs are enabled, this
 // also runs the API engines.
 func (sb *Statusbar) Run() {
@@ -120,35 +298,42 @@ func (sb *Statusbar) Run() {
 	// Add a signal handler so we can clear the statusbar if the program goes down.
 	go sb.handleSignal()
 
-	// Slice of strings to hold the output from each routine
-	outputs := make([]string, len(sb.routines))
-
-	// Shared channel used to pass the slice of outputs
-	outputsChan := make(chan []string, 1)
-	outputsChan <- outputs
-
 	// Set up a channel used to indicate everything is done. This must have a buffer large enough
 	// for every channel to send on without blocking.
-	finished := make(chan *routine, len(sb.routines))
+	routines := sb.routineList()
+	sb.finished = make(chan *routine, len(routines))
 
 	// Run each routine.
-	for i, v := range sb.routines {
-		go v.run(i, outputsChan, finished)
+	sb.mutex.Lock()
+	sb.live = len(routines)
+	sb.mutex.Unlock()
+	for _, v := range routines {
+		v.setHistorySize(sb.historySize)
+		v.setAlerts(sb.alerts)
+		v.setStore(sb.store)
+		v.setFeed(sb.feed)
+		go v.run(sb.finished)
 	}
 
 	// Flag that we're running now.
 	sb.running = true
 
 	// Launch a goroutine to build and print the master string.
-	go sb.buildBar(outputsChan)
+	go sb.buildBar()
 
 	// If enabled, build and run the APIs in their own goroutine.
 	go sb.runAPIs()
 
-	// Keep running until every routine stops.
-	for range sb.routines {
-		r := <-finished
+	// Keep running until every routine stops. Routines can be restarted through the APIs, so we
+	// need to keep count of how many are still running instead of waiting for each one once.
+	for live := len(routines); live > 0; {
+		r := <-sb.finished
 		log.Printf("%v: Routine stopped", r.displayName())
+
+		sb.mutex.Lock()
+		sb.live--
+		live = sb.live
+		sb.mutex.Unlock()
 	}
 	log.Printf("All routines have stopped")
 
@@ -170,7 +355,7 @@ func (sb *Statusbar) Stop() {
 	sb.stopAPIs()
 
 	// Stop all running routines.
-	for _, r := range sb.routines {
+	for _, r := range sb.routineList() {
 		// Make sure the anonymous function closes over the correct routine.
 		go func(r *routine) {
 			if !r.stop(5) {
@@ -203,12 +388,78 @@ func (sb *Statusbar) SetMarkers(left string, right string) {
 }
 
 // Split splits the statusbar at this point, when using the dualstatus patch for dwm. Internally, a
-// semicolon (';') is inserted at this point in the routine list, which signals to dualstatus to
-// split the statusbar at this point. Before this is called, the routines already added are
-// displayed on the main bar. After this is called, all subsequently added routines are displayed on
-// the secondary bar.
+// semicolon (';') is inserted between the routines on the main bar and the routines on the
+// secondary bar, which signals to dualstatus to split the statusbar at this point. Before this is
+// called, the routines already added are displayed on the main bar. After this is called, all
+// subsequently added routines are displayed on the secondary bar.
 func (sb *Statusbar) Split() {
-	sb.split = len(sb.routines) - 1
+	sb.splitting = true
+}
+
+// SetHistorySize sets the number of metric samples to keep for each routine that implements
+// MetricsReporter. Once a routine's history is full, the oldest sample is dropped for every new one.
+// This must be called before Run. The default is 60 samples.
+func (sb *Statusbar) SetHistorySize(samples int) {
+	if samples > 0 {
+		sb.historySize = samples
+	}
+}
+
+// AddAlert adds a rule for sending alerts when routines change state. For example, this rule sends a
+// desktop notification whenever the sbtravisci routine's latest build fails, but no more than once
+// every 5 minutes:
+//	bar.AddAlert(alert.Rule{
+//		Routine:   "sbtravisci",
+//		To:        statusbar.StateWarning,
+//		Interval:  5 * time.Minute,
+//		Notifiers: []alert.Notifier{alert.NewDBus(0)},
+//	})
+// See the alert package for more information on rules and notifiers. This must be called before
+// Run.
+func (sb *Statusbar) AddAlert(rule alert.Rule) {
+	if sb.alerts == nil {
+		sb.alerts = alert.NewDispatcher()
+	}
+
+	sb.alerts.AddRule(rule)
+}
+
+// EnableStateStore enables saving the state of every routine that implements Persister to disk, so
+// that the routines can pick up where they left off after a restart. The state files are kept in
+// dir. If dir is empty, then they are kept in $XDG_STATE_HOME/statusbar (or
+// ~/.local/state/statusbar if XDG_STATE_HOME is not set). This returns an error if the directory
+// cannot be created. This must be called before Run.
+func (sb *Statusbar) EnableStateStore(dir string) error {
+	store, err := newStateStore(dir)
+	if err != nil {
+		return err
+	}
+
+	sb.store = store
+	return nil
+}
+
+// SetStaleness sets how the engine handles old output. If a routine has not updated successfully in
+// more than age, then its output is marked as stale (see SetStaleStyle). If age is 0 (the default),
+// then output never goes stale with time alone. If keep is true, then the engine keeps showing a
+// routine's last good output, marked as stale, when its update fails instead of replacing it with
+// the routine's error message.
+func (sb *Statusbar) SetStaleness(age time.Duration, keep bool) {
+	if age >= 0 {
+		sb.stale.age = age
+	}
+	sb.stale.keep = keep
+}
+
+// SetStaleStyle sets how stale output is marked. marker is shown before the output. If color is a
+// hex color code (like "#888888"), then the output is shown in that color instead of its own
+// colors. The default is a marker of "~" and no color.
+func (sb *Statusbar) SetStaleStyle(marker string, color string) {
+	sb.stale.marker = marker
+	sb.stale.color = ""
+	if color != "" {
+		sb.stale.color = "^c" + color + "^"
+	}
 }
 
 // Uptime returns the time in seconds denoting how long the statusbar has been running.
@@ -223,55 +474,294 @@ func (sb *Statusbar) EnableRESTAPI(port int) {
 	sb.restPort = port
 }
 
+// EnableRESTSocket enables the engine to run the REST API on a Unix socket at path. If path is
+// empty, then the socket is created at $XDG_RUNTIME_DIR/statusbar/rest.sock. Only the current user
+// can connect to the socket, and requests over it don't need a token. This can be used instead of
+// or alongside EnableRESTAPI, for example to control the statusbar from scripts without opening a
+// TCP port.
+func (sb *Statusbar) EnableRESTSocket(path string) error {
+	if path == "" {
+		dir := os.Getenv("XDG_RUNTIME_DIR")
+		if dir == "" {
+			return fmt.Errorf("XDG_RUNTIME_DIR is not set")
+		}
+		path = filepath.Join(dir, "statusbar", "rest.sock")
+	}
+
+	sb.restSocket = path
+	return nil
+}
+
+// EnableRESTTLS serves the REST API over HTTPS on the port set with EnableRESTAPI, using the
+// certificate and key in the provided files. This is recommended if the API is opened up to other
+// machines with SetRESTAddress.
+func (sb *Statusbar) EnableRESTTLS(certFile, keyFile string) error {
+	if certFile == "" || keyFile == "" {
+		return fmt.Errorf("missing certificate or key file")
+	}
+
+	sb.restCert = certFile
+	sb.restKey = keyFile
+	return nil
+}
+
+// SetRESTAddress sets the host or IP address that the REST API listens on, e.g. "0.0.0.0" to accept
+// connections from other machines. By default, the REST API only listens on the loopback interface
+// (127.0.0.1). If you open the API up to the network, you should also add a token with
+// AddRESTToken or AddRESTTokenFile.
+func (sb *Statusbar) SetRESTAddress(host string) {
+	sb.restHost = host
+}
+
+// RebindRESTAPI moves the REST API to a new host and port while the statusbar is running, for
+// example if the port it was set to listen on turned out to be in use. The REST API starts
+// listening on the new address before it stops listening on the old one. If it can't listen on the
+// new address, then it keeps listening on the old one and the error is returned. If the statusbar
+// is not running yet, then this is the same as calling SetRESTAddress and EnableRESTAPI. host must
+// not be empty; use "127.0.0.1" to only accept connections from the local machine.
+func (sb *Statusbar) RebindRESTAPI(host string, port int) error {
+	if host == "" {
+		return fmt.Errorf("missing host")
+	}
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("invalid port: %d", port)
+	}
+
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+
+	if sb.restEngine != nil {
+		if err := sb.restEngine.Rebind(host, port); err != nil {
+			return err
+		}
+	}
+
+	sb.restHost = host
+	sb.restPort = port
+
+	return nil
+}
+
+// AddRESTToken adds a bearer token that grants access to the REST API. Once a token is added, every
+// request must send one in the Authorization header ("Authorization: Bearer <token>") or it will be
+// rejected with 401 Unauthorized. If readOnly is true, then the token only grants access to
+// endpoints that don't change anything (the GET endpoints), and other requests will be rejected
+// with 403 Forbidden.
+func (sb *Statusbar) AddRESTToken(token string, readOnly bool) error {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return fmt.Errorf("empty token")
+	}
+
+	scope := restapi.ScopeWrite
+	if readOnly {
+		scope = restapi.ScopeRead
+	}
+	sb.restTokens = append(sb.restTokens, restToken{token, scope})
+
+	return nil
+}
+
+// AddRESTTokenFile reads a token from the file at path and adds it like AddRESTToken. This keeps the
+// token out of the source code. The file should contain only the token.
+func (sb *Statusbar) AddRESTTokenFile(path string, readOnly bool) error {
+	token, err := restapi.ReadTokenFile(path)
+	if err != nil {
+		return err
+	}
+
+	return sb.AddRESTToken(token, readOnly)
+}
+
 // buildBar builds the master output and prints it to the statusbar. This runs a loop twice a second
 // to catch any changes that run every second (the minimum time).
-func (sb *Statusbar) buildBar(outputsChan chan []string) {
+func (sb *Statusbar) buildBar() {
 	for sb.running {
 		// Start the clock.
 		start := time.Now()
-		b := new(strings.Builder)
-
-		// Receive the outputs slice and build the individual outputs into a master output.
-		outputs := <-outputsChan
-		for i, s := range outputs {
-			if len(s) > 0 {
-				b.WriteString(sb.leftDelim)
-
-				// Shorten outputs that are longer than 60 characters.
-				if len(s) > 60 {
-					// If the output ends with the color terminator, then we need to make sure to
-					// keep that so the color doesn't bleed onto the delimiter and beyond.
-					hasColor := strings.HasSuffix(s, "^d^")
-					s = s[:56] + "..."
-					if hasColor {
-						s += "^d^"
-					}
-				}
-				b.WriteString(s)
 
-				b.WriteString(sb.rightDelim)
-				b.WriteByte(' ')
+		// Build the individual outputs into a master output and send it to the statusbar.
+		f := sb.renderFrame(start)
+		setBar(f.Output)
+		sb.feed.setFrame(f)
+
+		// Put the routine to sleep for the rest of the half second.
+		time.Sleep((time.Second / 2) - time.Since(start))
+	}
+}
+
+// renderFrame builds the master output from the routines' individual outputs. Routines on the main
+// bar come first, followed by the routines on the secondary bar (if the bar is split).
+func (sb *Statusbar) renderFrame(t time.Time) frame {
+	routines := sb.routineList()
+	b := new(strings.Builder)
+	f := frame{
+		Time:     t.Unix(),
+		Regions:  make(map[string]string),
+		Routines: make([]frameRoutine, 0, len(routines)),
+	}
+
+	// Sort the routines into their regions.
+	var main, secondary []*routine
+	for _, r := range routines {
+		if r.getBar() == regionSecondary {
+			secondary = append(secondary, r)
+		} else {
+			main = append(main, r)
+		}
+	}
+
+	regions := []struct {
+		name     string
+		routines []*routine
+	}{
+		{regionMain, main},
+		{regionSecondary, secondary},
+	}
+
+	for i, region := range regions {
+		if i > 0 {
+			if !sb.splitting && len(region.routines) == 0 {
+				break
 			}
+			// Insert the breaking delimiter here.
+			b.WriteByte(';')
+		}
 
-			if i == sb.split {
-				// Insert the breaking delimiter here.
-				b.WriteByte(';')
+		regionStart := b.Len()
+		for _, r := range region.routines {
+			s := r.display(sb.stale)
+			if len(s) == 0 {
+				continue
 			}
+
+			b.WriteString(sb.leftDelim)
+
+			// Shorten outputs that are longer than 60 characters. We need to count runes instead
+			// of bytes so we don't split any multi-byte characters (like sparklines) in half.
+			if utf8.RuneCountInString(s) > 60 {
+				// If the output ends with the color terminator, then we need to make sure to
+				// keep that so the color doesn't bleed onto the delimiter and beyond.
+				hasColor := strings.HasSuffix(s, "^d^")
+				s = string([]rune(s)[:56]) + "..."
+				if hasColor {
+					s += "^d^"
+				}
+			}
+			b.WriteString(s)
+
+			b.WriteString(sb.rightDelim)
+			b.WriteByte(' ')
+
+			f.Routines = append(f.Routines, frameRoutine{
+				Module: r.moduleName(),
+				Name:   r.displayName(),
+				Bar:    region.name,
+				Output: s,
+			})
 		}
-		outputsChan <- outputs
+		f.Regions[region.name] = strings.TrimSuffix(b.String()[regionStart:], " ")
+	}
+
+	f.Output = "No output" // Default if nothing else is available
+	if b.Len() > 0 {
+		f.Output = strings.TrimSuffix(b.String(), " ") // Remove last space.
+	}
+
+	return f
+}
+
+// routineList returns the current list of routines, in display order.
+func (sb *Statusbar) routineList() []*routine {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
 
-		s := "No output" // Default if nothing else is available
-		if b.Len() > 0 {
-			s = b.String()
-			s = s[:b.Len()-1] // Remove last space.
+	return sb.routines
+}
+
+// findRoutine returns the routine with the ID, or nil if there isn't one.
+func (sb *Statusbar) findRoutine(id string) *routine {
+	for _, r := range sb.routineList() {
+		if r.id == id {
+			return r
 		}
+	}
 
-		// Send the master output to the statusbar.
-		setBar(s)
+	return nil
+}
 
-		// Put the routine to sleep for the rest of the half second.
-		time.Sleep((time.Second / 2) - time.Since(start))
+// moveRoutine moves the routine to the region of the bar and to position within that region. A
+// position past the end of the region moves the routine to the end.
+func (sb *Statusbar) moveRoutine(r *routine, bar string, position int) {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+
+	// Build a new list without the routine.
+	routines := make([]*routine, 0, len(sb.routines))
+	for _, v := range sb.routines {
+		if v != r {
+			routines = append(routines, v)
+		}
+	}
+
+	// Find where in the overall list the position within the region falls.
+	index := len(routines)
+	seen := 0
+	for i, v := range routines {
+		if v.getBar() != bar {
+			continue
+		}
+		if seen == position {
+			index = i
+			break
+		}
+		seen++
+		index = i + 1
+	}
+
+	r.setBar(bar)
+	routines = append(routines[:index], append([]*routine{r}, routines[index:]...)...)
+	sb.routines = routines
+}
+
+// position returns the routine's position within its region of the bar.
+func (sb *Statusbar) position(r *routine) int {
+	bar := r.getBar()
+	position := 0
+	for _, v := range sb.routineList() {
+		if v == r {
+			break
+		}
+		if v.getBar() == bar {
+			position++
+		}
 	}
+
+	return position
+}
+
+// restartRoutine stops the routine (if it is running) and starts it again.
+func (sb *Statusbar) restartRoutine(r *routine) error {
+	// Count the routine as live before stopping it so the engine doesn't think every routine has
+	// stopped in the meantime.
+	sb.mutex.Lock()
+	if !sb.running || sb.finished == nil {
+		sb.mutex.Unlock()
+		return fmt.Errorf("statusbar is not running")
+	}
+	sb.live++
+	sb.mutex.Unlock()
+
+	if !r.stop(5) || !r.waitStopped(5) {
+		sb.mutex.Lock()
+		sb.live--
+		sb.mutex.Unlock()
+		return fmt.Errorf("failed to stop routine")
+	}
+
+	go r.run(sb.finished)
+
+	return nil
 }
 
 // setBar prints s to the statusbar.
@@ -298,9 +788,18 @@ func (sb *Statusbar) handleSignal() {
 // runAPIs runs the various APIs and their versions using the callback methods implemented by
 // handler. New APIs/versions should be added here.
 func (sb *Statusbar) runAPIs() {
-	if sb.restPort > 0 {
+	if sb.restPort > 0 || sb.restSocket != "" {
 		// Begin with the REST API.
 		r := restapi.NewEngine()
+		r.EnableDocs()
+		if sb.restHost != "" {
+			r.SetAddress(sb.restHost)
+		}
+		for _, t := range sb.restTokens {
+			if err := r.AddToken(t.value, t.scope); err != nil {
+				log.Printf("Error adding REST API token: %s", err.Error())
+			}
+		}
 
 		// Spin up REST API v1. Use an apiHandler to wrap the statusbar object for convenience (see
 		// type definition).
@@ -309,15 +808,86 @@ func (sb *Statusbar) runAPIs() {
 			log.Printf("Error building REST API v1: %s", err.Error())
 			sb.restEngine = nil
 		} else {
-			// Now that everything looks good, we can save this engine and start it up.
+			// Spin up REST API v2 alongside v1.
+			s = strings.NewReader(apispecs.RESTV2)
+			if err := r.AddSpecReader(s, apiV2Handler{apiHandler{sb}}); err != nil {
+				log.Printf("Error building REST API v2: %s", err.Error())
+			}
+
+			// Add the endpoints that routines provide for themselves.
+			sb.mountEndpoints(r, "/rest/v1/routines/:routine", (*routine).moduleName)
+			sb.mountEndpoints(r, "/rest/v2/routines/:routine", func(r *routine) string { return r.id })
+
+			// Now that everything looks good, we can save this engine and start it up. We keep the
+			// engine even if it can't listen on the port, so that it can still be moved to another
+			// one with RebindRESTAPI.
+			sb.mutex.Lock()
 			sb.restEngine = r
-			sb.restEngine.Run(sb.restPort)
+			sb.mutex.Unlock()
+
+			var tlsErr error
+			if sb.restCert != "" {
+				if tlsErr = r.SetTLS(sb.restCert, sb.restKey); tlsErr != nil {
+					// Don't fall back to plain HTTP if TLS was requested.
+					log.Printf("Error setting up TLS for REST API: %s", tlsErr.Error())
+				}
+			}
+			if sb.restPort > 0 && tlsErr == nil {
+				if err := r.Run(sb.restPort); err != nil {
+					log.Printf("Error running REST API on port %d: %s", sb.restPort, err.Error())
+				}
+			}
+			if sb.restSocket != "" {
+				if err := sb.restEngine.RunUnix(sb.restSocket, 0o600); err != nil {
+					log.Printf("Error running REST API on %s: %s", sb.restSocket, err.Error())
+				}
+			}
+		}
+	}
+}
+
+// mountEndpoints adds the endpoints of every routine that implements EndpointProvider to the REST
+// API engine under prefix, using key to get the value of the prefix's routine parameter for each
+// routine. If more than one routine has the same key, then only the first one's endpoints are added.
+func (sb *Statusbar) mountEndpoints(e *restapi.Engine, prefix string, key func(*routine) string) {
+	mounted := make(map[string]bool)
+	for _, r := range sb.routineList() {
+		provider, ok := r.handler.(EndpointProvider)
+		if !ok {
+			continue
+		}
+
+		// v1 finds routines by module name, so another routine of the same module would collide.
+		if mounted[key(r)] {
+			log.Printf("Skipping REST API endpoints for %s: %s is already taken", r.displayName(), key(r))
+			continue
+		}
+		mounted[key(r)] = true
+
+		spec, handler := provider.Endpoints()
+		spec.Prefix = prefix
+
+		r := r
+		done := func(endpoint restapi.Endpoint, code int) {
+			if code < 300 && endpoint.Method != http.MethodGet && r.isActive() {
+				// Don't block the request if an update is already waiting to happen.
+				select {
+				case r.updateChan <- struct{}{}:
+				default:
+				}
+			}
+		}
+		if err := e.AddSpecFor(spec, handler, "routine", key(r), done); err != nil {
+			log.Printf("Error adding REST API endpoints for %s: %s", r.displayName(), err.Error())
 		}
 	}
 }
 
 // stopAPIs stops the various APIs. New APIs/versions should be added here.
 func (sb *Statusbar) stopAPIs() {
+	// Disconnect anyone listening to the feed so the streams can close.
+	sb.feed.close()
+
 	// Begin with the REST API. Give it 5 seconds to shut down.
 	if sb.restEngine != nil {
 		if err := sb.restEngine.Stop(5); err == nil {
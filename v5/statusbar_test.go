@@ -49,3 +49,103 @@ func TestStatusbar(t *testing.T) {
 
 	t.Log("Statusbar stopped successfully")
 }
+
+// persistHandler is a routine that saves a piece of data with the state store.
+type persistHandler struct {
+	data string
+}
+
+func (p *persistHandler) Update() (bool, error)     { return true, nil }
+func (p *persistHandler) String() string            { return p.data }
+func (p *persistHandler) Error() string             { return "error" }
+func (p *persistHandler) Name() string              { return "Persist" }
+func (p *persistHandler) Save() ([]byte, error)     { return []byte(p.data), nil }
+func (p *persistHandler) Restore(data []byte) error { p.data = string(data); return nil }
+
+func TestStateStoreSameModule(t *testing.T) {
+	// Two routines of the same module should each get their own state back.
+	dir := t.TempDir()
+
+	bar := New()
+	if err := bar.EnableStateStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	bar.Append(&persistHandler{data: "first"}, 1)
+	bar.Append(&persistHandler{data: "second"}, 1)
+	for _, r := range bar.routines {
+		r.setStore(bar.store)
+		r.persist(r.handler.String())
+	}
+
+	bar = New()
+	if err := bar.EnableStateStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	bar.Append(&persistHandler{}, 1)
+	bar.Append(&persistHandler{}, 1)
+	for i, want := range []string{"first", "second"} {
+		r := bar.routines[i]
+		r.setStore(bar.store)
+		r.restore()
+		if got := r.handler.String(); got != want {
+			t.Errorf("routine %v: restored %q, want %q", r.id, got, want)
+		}
+	}
+}
+
+// stepHandler is a routine whose updates are run one at a time by the test.
+type stepHandler struct {
+	// Receives a value when Update starts.
+	updates chan struct{}
+
+	// Update waits for a value on this and returns it as its ok result.
+	results chan bool
+}
+
+func (s *stepHandler) Update() (bool, error) {
+	s.updates <- struct{}{}
+	return <-s.results, nil
+}
+
+func (s *stepHandler) String() string { return "step" }
+func (s *stepHandler) Error() string  { return "error" }
+func (s *stepHandler) Name() string   { return "Step" }
+
+func TestRestartStoppedRoutine(t *testing.T) {
+	// A routine that stops itself while a stop request is waiting should still run again when it is
+	// restarted.
+	h := &stepHandler{updates: make(chan struct{}), results: make(chan bool)}
+	bar := New()
+	bar.Append(h, 1)
+	r := bar.routines[0]
+
+	bar.running = true
+	bar.finished = make(chan *routine, 1)
+	go r.run(bar.finished)
+
+	<-h.updates
+	if !r.stop(1) {
+		t.Fatal("failed to stop routine")
+	}
+	h.results <- false
+	<-bar.finished
+
+	if err := bar.restartRoutine(r); err != nil {
+		t.Fatal(err)
+	}
+	<-h.updates
+	h.results <- true
+
+	select {
+	case <-h.updates:
+		// The routine is still running.
+	case <-bar.finished:
+		t.Fatal("routine stopped right after restarting")
+	case <-time.After(5 * time.Second):
+		t.Fatal("routine did not update again")
+	}
+
+	r.stop(1)
+	h.results <- true
+	<-bar.finished
+}
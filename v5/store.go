@@ -0,0 +1,99 @@
+// This file holds the logic for saving routines' state to disk so it survives restarts.
+
+package statusbar
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateStore saves and loads the state of each routine, with one JSON file per routine. The
+// files are named after the routines' IDs so that routines of the same module don't share a file.
+type stateStore struct {
+	// Directory that holds the state files.
+	dir string
+}
+
+// savedState is the state that is saved for each routine.
+type savedState struct {
+	// Time the state was saved.
+	Time time.Time `json:"time"`
+
+	// Routine's last good output.
+	Output string `json:"output"`
+
+	// Routine's data, as returned by its Save method.
+	Data []byte `json:"data"`
+}
+
+// newStateStore creates a new store in dir, creating the directory if needed. If dir is empty, then
+// the default directory is used: $XDG_STATE_HOME/statusbar, or ~/.local/state/statusbar if
+// XDG_STATE_HOME is not set.
+func newStateStore(dir string) (*stateStore, error) {
+	if dir == "" {
+		base := os.Getenv("XDG_STATE_HOME")
+		if base == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			base = filepath.Join(home, ".local", "state")
+		}
+		dir = filepath.Join(base, "statusbar")
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &stateStore{dir: dir}, nil
+}
+
+// load reads the saved state for the routine with the ID.
+func (s *stateStore) load(id string) (savedState, error) {
+	if s == nil {
+		return savedState{}, fmt.Errorf("invalid store")
+	}
+
+	b, err := ioutil.ReadFile(s.path(id))
+	if err != nil {
+		return savedState{}, err
+	}
+
+	state := savedState{}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return savedState{}, err
+	}
+
+	return state, nil
+}
+
+// save writes the state for the routine with the ID. The state is written to a temporary file first and then
+// moved into place so that a crash can't leave behind a partial file.
+func (s *stateStore) save(id string, state savedState) error {
+	if s == nil {
+		return fmt.Errorf("invalid store")
+	}
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	path := s.path(id)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// path returns the path to the state file of the routine with the ID.
+func (s *stateStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}